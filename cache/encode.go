@@ -0,0 +1,122 @@
+package cache
+
+import (
+	"bytes"
+	"compress/zlib"
+	"time"
+
+	"github.com/adjust/gorails/marshal"
+)
+
+// DefaultCompressThreshold is the size in bytes from which Rails compresses
+// cache entries by default.
+const DefaultCompressThreshold = 1024
+
+// Format is the layout of an encoded cache entry.
+type Format byte
+
+const (
+	// FormatMarshal is a marshalled ActiveSupport::Cache::Entry object,
+	// written by Rails 5.2 to 7.0 with the default cache_format_version.
+	FormatMarshal Format = iota
+	// Format70 is the output of the cache format 7.0 coder, the default of
+	// Rails 7.0 apps with load_defaults 7.0. Rails 7.1 reads it as well.
+	Format70
+)
+
+// Options configure how Encode writes an entry.
+type Options struct {
+	Format Format
+
+	// ExpiresAt is the time the entry expires at, or ExpiresIn the duration
+	// after which it expires. The entry never expires if both are zero.
+	ExpiresAt time.Time
+	ExpiresIn time.Duration
+
+	Version string
+
+	// CompressThreshold is the size of the marshalled value from which it
+	// is compressed, e.g. DefaultCompressThreshold. Zero disables
+	// compression. Values that do not shrink are stored uncompressed.
+	CompressThreshold int
+}
+
+// Encode returns a cache entry holding value that Rails reads with
+// Rails.cache.read. The value is marshalled as with marshal.Marshal.
+func Encode(value interface{}, opts Options) ([]byte, error) {
+	expiresAt := opts.ExpiresAt
+	if expiresAt.IsZero() && opts.ExpiresIn > 0 {
+		expiresAt = time.Now().Add(opts.ExpiresIn)
+	}
+
+	var expires, version interface{}
+	if !expiresAt.IsZero() {
+		expires = float64(expiresAt.UnixNano()) / 1e9
+	}
+	if opts.Version != "" {
+		version = opts.Version
+	}
+
+	if opts.Format == Format70 {
+		return encode70(value, expires, version, opts.CompressThreshold)
+	}
+
+	data, err := marshal.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	// As of Rails 6.1 @expires_in holds the expiry time and @created_at is
+	// 0.0, which older versions read correctly as well.
+	ivars := map[string]interface{}{
+		"@value":      value,
+		"@version":    version,
+		"@created_at": 0.0,
+		"@expires_in": expires,
+	}
+
+	if compressed, ok := compress(data, opts.CompressThreshold); ok {
+		ivars["@value"] = compressed
+		ivars["@compressed"] = true
+	}
+
+	return marshal.Marshal(marshal.Object{Class: entryClass, Ivars: ivars})
+}
+
+func encode70(value, expires, version interface{}, threshold int) ([]byte, error) {
+	members := []interface{}{value, expires, version}
+	for len(members) > 0 && members[len(members)-1] == nil {
+		members = members[:len(members)-1]
+	}
+
+	data, err := marshal.Marshal(members)
+	if err != nil {
+		return nil, err
+	}
+
+	if compressed, ok := compress(data, threshold); ok {
+		return append([]byte{mark70Compressed}, compressed...), nil
+	}
+
+	return append([]byte{mark70Uncompressed}, data...), nil
+}
+
+// compress deflates data if it is at least threshold bytes long and the
+// result is smaller.
+func compress(data []byte, threshold int) ([]byte, bool) {
+	if threshold <= 0 || len(data) < threshold {
+		return nil, false
+	}
+
+	var buf bytes.Buffer
+
+	w := zlib.NewWriter(&buf)
+	w.Write(data)
+	w.Close()
+
+	if buf.Len() >= len(data) {
+		return nil, false
+	}
+
+	return buf.Bytes(), true
+}
@@ -0,0 +1,96 @@
+package cache
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adjust/gorails/marshal"
+)
+
+type encodeTestCase struct {
+	Value      interface{}
+	Options    Options
+	Inspect    string
+	Compressed bool
+}
+
+func TestEncode(t *testing.T) {
+	expiresAt := time.Unix(1700000000, 500000000)
+	long := strings.Repeat("a", 2000)
+
+	tests := []encodeTestCase{
+		{"bar", Options{}, `"bar"`, false},
+		{[]int{1, 2}, Options{Version: "v1", ExpiresAt: expiresAt}, "[1, 2]", false},
+		{nil, Options{ExpiresAt: expiresAt}, "nil", false},
+		{long, Options{CompressThreshold: DefaultCompressThreshold}, `"` + long + `"`, true},
+		{long, Options{}, `"` + long + `"`, false},
+		{"bar", Options{Format: Format70}, `"bar"`, false},
+		{[]int{1, 2}, Options{Format: Format70, Version: "v1", ExpiresAt: expiresAt}, "[1, 2]", false},
+		{nil, Options{Format: Format70, Version: "v1"}, "nil", false},
+		{long, Options{Format: Format70, CompressThreshold: DefaultCompressThreshold}, `"` + long + `"`, true},
+		// short values do not shrink when compressed
+		{"\x9c\x4e\x1f\xd3", Options{Format: Format70, CompressThreshold: 1}, `"\x9CN\x1F\xD3"`, false},
+	}
+
+	for _, testCase := range tests {
+		data, err := Encode(testCase.Value, testCase.Options)
+		if err != nil {
+			t.Errorf("Encode(%v) returned an error: %v", testCase.Value, err)
+			continue
+		}
+
+		entry, err := Decode(data)
+		if err != nil {
+			t.Errorf("Decode() returned an error for the output of Encode(%v): %v", testCase.Value, err)
+			continue
+		}
+
+		if value := entry.Value.Inspect(); value != testCase.Inspect {
+			t.Errorf("Encode(%v) stored %v", testCase.Value, value)
+		}
+		if !entry.ExpiresAt.Equal(testCase.Options.ExpiresAt) {
+			t.Errorf("Encode(%v) stored expiry %v instead of %v", testCase.Value, entry.ExpiresAt, testCase.Options.ExpiresAt)
+		}
+		if entry.Version != testCase.Options.Version {
+			t.Errorf("Encode(%v) stored version %q instead of %q", testCase.Value, entry.Version, testCase.Options.Version)
+		}
+
+		var compressed bool
+		if testCase.Options.Format == Format70 {
+			compressed = data[0] == mark70Compressed
+		} else {
+			ivars, _ := marshal.CreateMarshalledObject(data).GetAsObject()
+			compressed = ivars["@compressed"] != nil
+		}
+		if compressed != testCase.Compressed {
+			t.Errorf("Encode(%v) compressed the entry: %v", testCase.Value, compressed)
+		}
+	}
+}
+
+func TestEncodeFormat70(t *testing.T) {
+	data, err := Encode("bar", Options{Format: Format70})
+	if err != nil {
+		t.Fatalf("Encode() returned an error: %v", err)
+	}
+
+	expectation := []byte{0, 4, 8, 91, 6, 73, 34, 8, 98, 97, 114, 6, 58, 6, 69, 84} // ["bar"]
+	if !bytes.Equal(data, expectation) {
+		t.Errorf("Encode() returned %v instead of %v", data, expectation)
+	}
+}
+
+func TestEncodeExpiresIn(t *testing.T) {
+	data, _ := Encode(1, Options{ExpiresIn: time.Hour})
+
+	entry, err := Decode(data)
+	if err != nil {
+		t.Fatalf("Decode() returned an error: %v", err)
+	}
+
+	if d := entry.ExpiresAt.Sub(time.Now()); d <= 59*time.Minute || d > time.Hour {
+		t.Errorf("Encode() stored an entry expiring in %v instead of 1h", d)
+	}
+}
@@ -0,0 +1,298 @@
+// Package cache reads and writes values shared with a Rails app through
+// Rails.cache, e.g. in Redis or memcached.
+package cache
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math"
+	"time"
+
+	"github.com/adjust/gorails/marshal"
+)
+
+var (
+	ErrUnknownFormat         = errors.New("cache: unknown entry format")
+	ErrMalformedEntry        = errors.New("cache: malformed entry")
+	ErrUnsupportedSerializer = errors.New("cache: unsupported value serializer")
+	ErrExpired               = errors.New("cache: entry expired")
+)
+
+const entryClass = "ActiveSupport::Cache::Entry"
+
+// Markers of the cache format 7.0 coder, which dumps [value, expires_at,
+// version] instead of an Entry object.
+const (
+	mark70Uncompressed = 0x00
+	mark70Compressed   = 0x01
+)
+
+// The Rails 7.1 coder prefixes the payload with a packed header:
+// signature, type, expires_at (float64) and version length (int32).
+const (
+	packedHeaderSize = 15
+	compressedFlag   = 0x80
+	objectDumpType   = 0x01
+	utf8StringType   = 0x02
+	binaryStringType = 0x03
+	asciiStringType  = 0x04
+)
+
+var (
+	packedSignature  = []byte{0x00, 0x11}
+	marshalSignature = []byte{0x04, 0x08}
+)
+
+// An Entry is a cached value along with its metadata.
+type Entry struct {
+	Value     *marshal.MarshalledObject
+	ExpiresAt time.Time // zero if the entry does not expire
+	Version   string    // empty if the entry is not versioned
+}
+
+// Expired reports whether the entry has expired, as Rails would.
+func (e *Entry) Expired() bool {
+	return !e.ExpiresAt.IsZero() && !time.Now().Before(e.ExpiresAt)
+}
+
+// Decode unwraps a raw cache value written by any Rails version from 4.0 on:
+// a marshalled ActiveSupport::Cache::Entry, optionally with a compressed
+// value, or the output of the cache format 7.0 and 7.1 coders. Expired
+// entries are returned as well, see Read.
+func Decode(data []byte) (*Entry, error) {
+	switch {
+	case bytes.HasPrefix(data, marshalSignature):
+		return decodeEntry(data)
+	case bytes.HasPrefix(data, packedSignature):
+		return decodePacked(data)
+	case len(data) > 0 && data[0] == mark70Uncompressed:
+		return decodeMembers(data[1:])
+	case len(data) > 0 && data[0] == mark70Compressed:
+		members, err := inflate(data[1:])
+		if err != nil {
+			return nil, err
+		}
+
+		return decodeMembers(members)
+	}
+
+	return nil, ErrUnknownFormat
+}
+
+// Read returns the value of a raw cache entry, or ErrExpired if the entry
+// has expired.
+func Read(data []byte) (*marshal.MarshalledObject, error) {
+	entry, err := Decode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry.Expired() {
+		return nil, ErrExpired
+	}
+
+	return entry.Value, nil
+}
+
+func decodeEntry(data []byte) (*Entry, error) {
+	obj, err := load(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if class, _ := obj.GetClassName(); class != entryClass {
+		return nil, ErrUnknownFormat
+	}
+
+	ivars, _ := obj.GetAsObject()
+
+	entry := &Entry{Value: ivars["@value"]}
+	if entry.Value == nil {
+		return nil, ErrMalformedEntry
+	}
+
+	if compressed := ivars["@compressed"]; compressed != nil {
+		if ok, _ := compressed.GetAsBool(); ok {
+			s, err := entry.Value.GetAsString()
+			if err != nil {
+				return nil, ErrMalformedEntry
+			}
+
+			if data, err = inflate([]byte(s)); err != nil {
+				return nil, err
+			}
+			if entry.Value, err = load(data); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	entry.Version = version(ivars["@version"])
+
+	// Until Rails 6.1 @expires_in is relative to @created_at, later
+	// versions set @created_at to 0.0 and store the expiry time.
+	if expiresAt, ok := number(ivars["@expires_at"]); ok {
+		entry.ExpiresAt = unixTime(expiresAt)
+	} else if expiresIn, ok := number(ivars["@expires_in"]); ok {
+		createdAt, _ := number(ivars["@created_at"])
+		entry.ExpiresAt = unixTime(createdAt + expiresIn)
+	}
+
+	return entry, nil
+}
+
+func decodeMembers(data []byte) (*Entry, error) {
+	obj, err := load(data)
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := obj.GetAsArray()
+	if err != nil || len(members) == 0 {
+		return nil, ErrMalformedEntry
+	}
+
+	entry := &Entry{Value: members[0]}
+	if len(members) > 1 {
+		if expiresAt, ok := number(members[1]); ok {
+			entry.ExpiresAt = unixTime(expiresAt)
+		}
+	}
+	if len(members) > 2 {
+		entry.Version = version(members[2])
+	}
+
+	return entry, nil
+}
+
+func decodePacked(data []byte) (*Entry, error) {
+	if len(data) < packedHeaderSize {
+		return nil, ErrMalformedEntry
+	}
+
+	typ := data[2]
+	expiresAt := math.Float64frombits(binary.LittleEndian.Uint64(data[3:11]))
+	versionLength := int32(binary.LittleEndian.Uint32(data[11:15]))
+	payload := data[packedHeaderSize:]
+
+	entry := &Entry{}
+	if expiresAt >= 0 {
+		entry.ExpiresAt = unixTime(expiresAt)
+	}
+
+	if versionLength >= 0 {
+		if int(versionLength) > len(payload) {
+			return nil, ErrMalformedEntry
+		}
+
+		v := payload[:versionLength]
+		payload = payload[versionLength:]
+
+		// Versions that are not UTF-8 strings are marshalled.
+		if bytes.HasPrefix(v, marshalSignature) {
+			obj, err := load(v)
+			if err != nil {
+				return nil, err
+			}
+			entry.Version = version(obj)
+		} else {
+			entry.Version = string(v)
+		}
+	}
+
+	if typ&compressedFlag != 0 {
+		var err error
+		if payload, err = inflate(payload); err != nil {
+			return nil, err
+		}
+		typ &^= compressedFlag
+	}
+
+	var value interface{}
+	switch typ {
+	case objectDumpType:
+		if !bytes.HasPrefix(payload, marshalSignature) {
+			return nil, ErrUnsupportedSerializer
+		}
+
+		var err error
+		if entry.Value, err = load(payload); err != nil {
+			return nil, err
+		}
+
+		return entry, nil
+	case utf8StringType, asciiStringType:
+		value = string(payload)
+	case binaryStringType:
+		value = payload
+	default:
+		return nil, ErrMalformedEntry
+	}
+
+	// Strings are stored as they are, so they are marshalled here to be
+	// returned like any other value.
+	data, err := marshal.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	entry.Value = marshal.CreateMarshalledObject(data)
+
+	return entry, nil
+}
+
+func load(data []byte) (*marshal.MarshalledObject, error) {
+	obj, err := marshal.NewDecoder(bytes.NewReader(data)).Decode()
+	if err == io.EOF {
+		return nil, ErrMalformedEntry
+	}
+
+	return obj, err
+}
+
+func inflate(data []byte) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrMalformedEntry
+	}
+	defer r.Close()
+
+	data, err = ioutil.ReadAll(r)
+	if err != nil {
+		return nil, ErrMalformedEntry
+	}
+
+	return data, nil
+}
+
+func version(obj *marshal.MarshalledObject) string {
+	if obj == nil || obj.GetType() == marshal.TYPE_NIL {
+		return ""
+	}
+
+	return obj.ToString()
+}
+
+func number(obj *marshal.MarshalledObject) (float64, bool) {
+	if obj == nil {
+		return 0, false
+	}
+
+	if f, err := obj.GetAsFloat(); err == nil {
+		return f, true
+	}
+	if i, err := obj.GetAsInteger(); err == nil {
+		return float64(i), true
+	}
+
+	return 0, false
+}
+
+func unixTime(seconds float64) time.Time {
+	sec, frac := math.Modf(seconds)
+
+	return time.Unix(int64(sec), int64(frac*1e9))
+}
@@ -0,0 +1,145 @@
+package cache
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/adjust/gorails/marshal"
+)
+
+func dump(v interface{}) []byte {
+	data, err := marshal.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+
+	return data
+}
+
+func deflate(data []byte) []byte {
+	var buf bytes.Buffer
+
+	w := zlib.NewWriter(&buf)
+	w.Write(data)
+	w.Close()
+
+	return buf.Bytes()
+}
+
+func packed(typ byte, expiresAt float64, version string, payload []byte) []byte {
+	data := []byte{0x00, 0x11, typ}
+	data = append(data, make([]byte, 12)...)
+
+	binary.LittleEndian.PutUint64(data[3:], math.Float64bits(expiresAt))
+	if version == "" {
+		binary.LittleEndian.PutUint32(data[11:], math.MaxUint32) // -1
+	} else {
+		binary.LittleEndian.PutUint32(data[11:], uint32(len(version)))
+		data = append(data, version...)
+	}
+
+	return append(data, payload...)
+}
+
+func entryObject(ivars map[string]interface{}) []byte {
+	return dump(marshal.Object{Class: "ActiveSupport::Cache::Entry", Ivars: ivars})
+}
+
+type decodeTestCase struct {
+	Data      []byte
+	Value     string
+	ExpiresAt time.Time
+	Version   string
+}
+
+func TestDecode(t *testing.T) {
+	tests := []decodeTestCase{
+		// Rails 4.x - 6.0
+		{entryObject(map[string]interface{}{"@value": "bar", "@created_at": 1500000000.5, "@expires_in": nil}), `"bar"`, time.Time{}, ""},
+		{entryObject(map[string]interface{}{"@value": 1, "@created_at": 1500000000.5, "@expires_in": 60.0, "@version": "v1"}), "1", time.Unix(1500000060, 500000000), "v1"},
+		{
+			entryObject(map[string]interface{}{"@value": deflate(dump([]int{1, 2})), "@compressed": true, "@created_at": 1500000000.0, "@expires_in": nil}),
+			"[1, 2]", time.Time{}, "",
+		},
+		// Rails 6.1 stores the expiry time in @expires_in
+		{entryObject(map[string]interface{}{"@value": "bar", "@created_at": 0.0, "@expires_in": 1700000000.25, "@version": nil}), `"bar"`, time.Unix(1700000000, 250000000), ""},
+		// Cache format 7.0
+		{append([]byte{0x00}, dump([]interface{}{"bar"})...), `"bar"`, time.Time{}, ""},
+		{append([]byte{0x00}, dump([]interface{}{"bar", nil, "v2"})...), `"bar"`, time.Time{}, "v2"},
+		{append([]byte{0x01}, deflate(dump([]interface{}{[]int{1}, 1700000000.0}))...), "[1]", time.Unix(1700000000, 0), ""},
+		// Rails 7.1
+		{packed(0x01, -1, "", dump(map[string]int{"a": 1})), `{"a"=>1}`, time.Time{}, ""},
+		{packed(0x02, 1700000000.5, "v3", []byte("bar")), `"bar"`, time.Unix(1700000000, 500000000), "v3"},
+		{packed(0x83, -1, string(dump(1)), deflate([]byte{0xff})), `"\xFF"`, time.Time{}, "1"},
+		{packed(0x81, 1700000000, "", deflate(dump(nil))), "nil", time.Unix(1700000000, 0), ""},
+	}
+
+	for _, testCase := range tests {
+		entry, err := Decode(testCase.Data)
+		if err != nil {
+			t.Errorf("Decode(%q) returned an error: %v", testCase.Data, err)
+			continue
+		}
+
+		if value := entry.Value.Inspect(); value != testCase.Value {
+			t.Errorf("Decode(%q) returned value %v instead of %v", testCase.Data, value, testCase.Value)
+		}
+
+		if !entry.ExpiresAt.Equal(testCase.ExpiresAt) {
+			t.Errorf("Decode(%q) returned expiry %v instead of %v", testCase.Data, entry.ExpiresAt, testCase.ExpiresAt)
+		}
+
+		if entry.Version != testCase.Version {
+			t.Errorf("Decode(%q) returned version %q instead of %q", testCase.Data, entry.Version, testCase.Version)
+		}
+	}
+}
+
+type decodeErrorTestCase struct {
+	Data  []byte
+	Error error
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []decodeErrorTestCase{
+		{nil, ErrUnknownFormat},
+		{[]byte("bar"), ErrUnknownFormat},
+		{dump("bar"), ErrUnknownFormat},
+		{entryObject(map[string]interface{}{"@version": nil}), ErrMalformedEntry},
+		{entryObject(map[string]interface{}{"@value": "bar", "@compressed": true}), ErrMalformedEntry},
+		{[]byte{0x00}, ErrMalformedEntry},
+		{append([]byte{0x00}, dump([]int{})...), ErrMalformedEntry},
+		{[]byte{0x01, 0x78}, ErrMalformedEntry},
+		{[]byte{0x00, 0x11, 0x01, 0, 0}, ErrMalformedEntry},
+		{packed(0x01, -1, "", []byte{0xcc, 0x80, 0xc0}), ErrUnsupportedSerializer},
+		{packed(0x01, -1, "", []byte{4, 8, 91}), marshal.IncompleteData},
+		{packed(0x05, -1, "", nil), ErrMalformedEntry},
+		{packed(0x02, -1, "v1", nil)[:16], ErrMalformedEntry},
+	}
+
+	for _, testCase := range tests {
+		if _, err := Decode(testCase.Data); err != testCase.Error {
+			t.Errorf("Decode(%q) returned error %v instead of %v", testCase.Data, err, testCase.Error)
+		}
+	}
+}
+
+func TestRead(t *testing.T) {
+	now := float64(time.Now().Unix())
+
+	if _, err := Read(packed(0x02, now-1, "", []byte("bar"))); err != ErrExpired {
+		t.Errorf("Read() returned error %v instead of %v for an expired entry", err, ErrExpired)
+	}
+
+	value, err := Read(packed(0x02, now+60, "", []byte("bar")))
+	if err != nil {
+		t.Fatalf("Read() returned an error: %v", err)
+	}
+	if s, _ := value.GetAsString(); s != "bar" {
+		t.Errorf("Read() returned %v instead of \"bar\"", value.Inspect())
+	}
+}
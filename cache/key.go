@@ -0,0 +1,272 @@
+package cache
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"math"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adjust/gorails/marshal"
+)
+
+// memcached rejects keys longer than 250 bytes.
+const memCacheKeyMaxSize = 250
+
+// CacheKeyer is implemented by values that provide their own cache key, like
+// ActiveRecord models.
+type CacheKeyer interface {
+	CacheKey() string
+}
+
+// VersionedCacheKeyer is implemented by values whose cache key includes
+// their version when expanded with ExpandKey.
+type VersionedCacheKeyer interface {
+	CacheKeyWithVersion() string
+}
+
+// Record holds what ActiveRecord builds the cache key and version of a
+// model instance from.
+type Record struct {
+	Model     string      // collection name of the model, e.g. "users" or "admin/users"
+	ID        interface{} // nil for a new record
+	UpdatedAt time.Time
+}
+
+// CacheKey returns the key of the record, e.g. "users/1".
+func (r Record) CacheKey() string {
+	if r.ID == nil {
+		return r.Model + "/new"
+	}
+
+	return r.Model + "/" + toParam(r.ID)
+}
+
+// CacheVersion returns the version of the record, the update time in UTC
+// with microseconds, or an empty string if the update time is unknown.
+func (r Record) CacheVersion() string {
+	if r.UpdatedAt.IsZero() {
+		return ""
+	}
+
+	return strings.Replace(r.UpdatedAt.UTC().Format("20060102150405.000000"), ".", "", 1)
+}
+
+// CacheKeyWithVersion returns the key of the record followed by its
+// version, e.g. "users/1-20240101120000123456".
+func (r Record) CacheKeyWithVersion() string {
+	if version := r.CacheVersion(); version != "" {
+		return r.CacheKey() + "-" + version
+	}
+
+	return r.CacheKey()
+}
+
+// ExpandKey returns the same key as ActiveSupport::Cache.expand_cache_key,
+// which is used e.g. for fragment caching. Keys of maps are sorted, as Go
+// maps do not keep the insertion order Rails uses for hashes.
+//
+// Like Rails, ExpandKey prefixes the key with the RAILS_CACHE_ID or the
+// RAILS_APP_VERSION environment variable if either is set.
+func ExpandKey(key interface{}, namespace string) string {
+	var expanded string
+	if namespace != "" {
+		expanded = namespace + "/"
+	}
+
+	if prefix := os.Getenv("RAILS_CACHE_ID"); prefix != "" {
+		expanded += prefix + "/"
+	} else if prefix := os.Getenv("RAILS_APP_VERSION"); prefix != "" {
+		expanded += prefix + "/"
+	}
+
+	return expanded + retrieveKey(key)
+}
+
+// Store produces the keys a Rails cache store reads and writes in the
+// backend for the keys passed to Rails.cache.
+type Store struct {
+	// Namespace is the :namespace option of the store.
+	Namespace string
+
+	// MemCache enables the key escaping and shortening of the memcache
+	// store. Keys over 250 bytes are cut and suffixed with DigestSeparator
+	// and the first 32 hex digits of their Digest. The defaults, MD5 and
+	// ":md5:", match Rails up to 6.0. Later versions use ":hash:" and the
+	// config.active_support.hash_digest_class digest.
+	MemCache        bool
+	Digest          func() hash.Hash
+	DigestSeparator string
+}
+
+// Key returns the backend key for key. Records contribute their cache key
+// only, as the version is stored in the entry.
+func (s Store) Key(key interface{}) string {
+	k := storeKey(key)
+	if s.Namespace != "" {
+		k = s.Namespace + ":" + k
+	}
+
+	if s.MemCache {
+		k = s.memCacheKey(k)
+	}
+
+	return k
+}
+
+func (s Store) memCacheKey(key string) string {
+	var escaped []byte
+	for i := 0; i < len(key); i++ {
+		if c := key[i]; c <= 0x20 || c == '%' || c >= 0x7f {
+			escaped = append(escaped, fmt.Sprintf("%%%X", c)...)
+		} else {
+			escaped = append(escaped, c)
+		}
+	}
+	key = string(escaped)
+
+	if len(key) <= memCacheKeyMaxSize {
+		return key
+	}
+
+	digest, separator := s.Digest, s.DigestSeparator
+	if digest == nil {
+		digest = md5.New
+	}
+	if separator == "" {
+		separator = ":md5:"
+	}
+
+	h := digest()
+	h.Write([]byte(key))
+	sum := hex.EncodeToString(h.Sum(nil))
+	if len(sum) > 32 {
+		sum = sum[:32]
+	}
+
+	return key[:memCacheKeyMaxSize-len(separator)-len(sum)] + separator + sum
+}
+
+// retrieveKey mirrors ActiveSupport::Cache.retrieve_cache_key.
+func retrieveKey(key interface{}) string {
+	switch k := key.(type) {
+	case VersionedCacheKeyer:
+		return k.CacheKeyWithVersion()
+	case CacheKeyer:
+		return k.CacheKey()
+	}
+
+	v := reflect.ValueOf(key)
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			break
+		}
+
+		elements := make([]string, v.Len())
+		for i := range elements {
+			elements[i] = retrieveKey(v.Index(i).Interface())
+		}
+
+		return strings.Join(elements, "/")
+	case reflect.Map:
+		// Hashes are converted to arrays of key-value pairs.
+		keys := sortedKeys(v)
+
+		elements := make([]string, 0, 2*len(keys))
+		for _, k := range keys {
+			elements = append(elements, retrieveKey(k), retrieveKey(v.MapIndex(reflect.ValueOf(k)).Interface()))
+		}
+
+		return strings.Join(elements, "/")
+	}
+
+	return toParam(key)
+}
+
+// storeKey mirrors ActiveSupport::Cache::Store#expanded_key.
+func storeKey(key interface{}) string {
+	if k, ok := key.(CacheKeyer); ok {
+		return k.CacheKey()
+	}
+
+	v := reflect.ValueOf(key)
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			break
+		}
+
+		elements := make([]string, v.Len())
+		for i := range elements {
+			elements[i] = storeKey(v.Index(i).Interface())
+		}
+
+		return strings.Join(elements, "/")
+	case reflect.Map:
+		elements := make([]string, 0, v.Len())
+		for _, k := range v.MapKeys() {
+			elements = append(elements, toParam(k.Interface())+"="+toParam(v.MapIndex(k).Interface()))
+		}
+		sort.Strings(elements)
+
+		return strings.Join(elements, "/")
+	}
+
+	return toParam(key)
+}
+
+func sortedKeys(v reflect.Value) []interface{} {
+	keys := make([]interface{}, 0, v.Len())
+	for _, k := range v.MapKeys() {
+		keys = append(keys, k.Interface())
+	}
+
+	sort.Sort(byParam(keys))
+
+	return keys
+}
+
+type byParam []interface{}
+
+func (k byParam) Len() int           { return len(k) }
+func (k byParam) Swap(i, j int)      { k[i], k[j] = k[j], k[i] }
+func (k byParam) Less(i, j int) bool { return toParam(k[i]) < toParam(k[j]) }
+
+// toParam mirrors Object#to_param for scalar values.
+func toParam(value interface{}) string {
+	switch x := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case marshal.Symbol:
+		return string(x)
+	case []byte:
+		return string(x)
+	}
+
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if f == math.Trunc(f) && math.Abs(f) < 1e16 {
+			return strconv.FormatFloat(f, 'f', 1, 64)
+		}
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+
+	return fmt.Sprint(value)
+}
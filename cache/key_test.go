@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+var user = Record{Model: "users", ID: 1, UpdatedAt: time.Date(2024, 1, 1, 13, 0, 0, 123456789, time.FixedZone("CET", 3600))}
+
+func TestRecord(t *testing.T) {
+	if key := user.CacheKeyWithVersion(); key != "users/1-20240101120000123456" {
+		t.Errorf("CacheKeyWithVersion() returned %q", key)
+	}
+
+	if key := (Record{Model: "users"}).CacheKeyWithVersion(); key != "users/new" {
+		t.Errorf("CacheKeyWithVersion() returned %q for a new record", key)
+	}
+}
+
+type expandKeyTestCase struct {
+	Key         interface{}
+	Namespace   string
+	Expectation string
+}
+
+func TestExpandKey(t *testing.T) {
+	tests := []expandKeyTestCase{
+		{"foo", "", "foo"},
+		{"foo", "views", "views/foo"},
+		{[]interface{}{"views", user}, "", "views/users/1-20240101120000123456"},
+		{[]interface{}{"a", nil, true, 1.0, 2.5}, "", "a//true/1.0/2.5"},
+		{map[string]interface{}{"b": 2, "a": []int{1, 2}}, "", "a/1/2/b/2"},
+	}
+
+	for _, testCase := range tests {
+		if key := ExpandKey(testCase.Key, testCase.Namespace); key != testCase.Expectation {
+			t.Errorf("ExpandKey(%v, %q) returned %q instead of %q", testCase.Key, testCase.Namespace, key, testCase.Expectation)
+		}
+	}
+
+	os.Setenv("RAILS_APP_VERSION", "v2")
+	defer os.Unsetenv("RAILS_APP_VERSION")
+
+	if key := ExpandKey("foo", "views"); key != "views/v2/foo" {
+		t.Errorf("ExpandKey() returned %q instead of %q with RAILS_APP_VERSION set", key, "views/v2/foo")
+	}
+}
+
+type storeKeyTestCase struct {
+	Store       Store
+	Key         interface{}
+	Expectation string
+}
+
+func TestStoreKey(t *testing.T) {
+	long := strings.Repeat("a", 300)
+
+	tests := []storeKeyTestCase{
+		{Store{}, "foo", "foo"},
+		{Store{Namespace: "app"}, []interface{}{"user", 1}, "app:user/1"},
+		{Store{}, []interface{}{"user"}, "user"},
+		{Store{}, user, "users/1"},
+		{Store{}, []interface{}{user, "posts"}, "users/1/posts"},
+		{Store{}, map[string]interface{}{"b": 2, "a": nil}, "a=/b=2"},
+		{Store{MemCache: true}, "foo bar%\xff\x05", "foo%20bar%25%FF%5"},
+		{Store{MemCache: true}, long[:250], long[:250]},
+		{Store{MemCache: true}, long, long[:213] + ":md5:4e5475d125a33c6190718e75adc1b704"},
+		{Store{MemCache: true, Digest: sha256.New, DigestSeparator: ":hash:"}, long, long[:212] + ":hash:9835fa6bf4e20a9b9ea812506302e989"},
+	}
+
+	for _, testCase := range tests {
+		if key := testCase.Store.Key(testCase.Key); key != testCase.Expectation {
+			t.Errorf("%+v.Key(%v) returned %q instead of %q", testCase.Store, testCase.Key, key, testCase.Expectation)
+		}
+	}
+}
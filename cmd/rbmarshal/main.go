@@ -0,0 +1,192 @@
+// Command rbmarshal prints Ruby Marshal data as JSON, in Ruby inspect format
+// or as an annotated byte dump, or generates Go struct definitions to
+// unmarshal it into.
+//
+// Usage:
+//
+//	rbmarshal [flags] [file]
+//
+// The input is read from file, or from stdin if no file is given. It may
+// contain several concatenated dumps, which are used as samples of the same
+// type with -out go.
+//
+// Exit codes:
+//
+//	0  success
+//	1  usage or I/O error
+//	2  malformed input
+//	3  input contains types that can not be converted to the output format
+//	4  input exceeds the decode limits
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/adjust/gorails/marshal"
+)
+
+const (
+	exitOK = iota
+	exitError
+	exitMalformed
+	exitUnsupported
+	exitLimitExceeded
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("rbmarshal", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+
+	input := flags.String("in", "raw", "input encoding: raw, base64 or hex")
+	output := flags.String("out", "inspect", "output format: json, inspect, annotate or go")
+	typeName := flags.String("type", "Payload", "name of the generated type with -out go")
+	pkg := flags.String("package", "main", "package of the generated type with -out go")
+	maxSize := flags.Int("max-size", 16<<20, "maximum size of a dump in bytes, 0 for no limit")
+	maxDepth := flags.Int("max-depth", 512, "maximum nesting depth of a dump, 0 for no limit")
+
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+
+	if flags.NArg() > 1 {
+		fmt.Fprintln(stderr, "rbmarshal: too many arguments")
+		return exitError
+	}
+
+	r := stdin
+	if flags.NArg() == 1 {
+		f, err := os.Open(flags.Arg(0))
+		if err != nil {
+			fmt.Fprintf(stderr, "rbmarshal: %v\n", err)
+			return exitError
+		}
+		defer f.Close()
+
+		r = f
+	}
+
+	raw, err := ioutil.ReadAll(r)
+	if err != nil {
+		fmt.Fprintf(stderr, "rbmarshal: %v\n", err)
+		return exitError
+	}
+
+	data, err := decodeInput(raw, *input)
+	if err != nil {
+		fmt.Fprintf(stderr, "rbmarshal: %v\n", err)
+		if err == errUnknownEncoding {
+			return exitError
+		}
+		return exitMalformed
+	}
+
+	switch *output {
+	case "json", "inspect", "annotate", "go":
+	default:
+		fmt.Fprintf(stderr, "rbmarshal: unknown output format %q\n", *output)
+		return exitError
+	}
+
+	d := marshal.NewDecoder(bytes.NewReader(data))
+	d.MaxSize = *maxSize
+	d.MaxDepth = *maxDepth
+
+	offset := 0
+	var samples []*marshal.MarshalledObject
+	for {
+		obj, err := d.Decode()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			fmt.Fprintf(stderr, "rbmarshal: %v\n", err)
+
+			switch err {
+			case marshal.LimitExceeded:
+				return exitLimitExceeded
+			case marshal.UnsupportedVersion:
+				return exitUnsupported
+			}
+			return exitMalformed
+		}
+
+		switch *output {
+		case "json":
+			var v interface{}
+			if err = obj.Unmarshal(&v); err == nil {
+				var b []byte
+				if b, err = json.Marshal(v); err == nil {
+					fmt.Fprintf(stdout, "%s\n", b)
+				}
+			}
+
+			if err != nil {
+				fmt.Fprintf(stderr, "rbmarshal: can not convert to JSON: %v\n", err)
+				return exitUnsupported
+			}
+		case "inspect":
+			fmt.Fprintln(stdout, obj.Inspect())
+		case "annotate":
+			// The decoder has already checked this dump against the limits.
+			annotations, _ := marshal.Annotate(data[offset:])
+			for _, a := range annotations {
+				a.Offset += offset
+				fmt.Fprintln(stdout, a)
+			}
+
+			offset += 2 + len(annotations[1].Bytes)
+		case "go":
+			samples = append(samples, obj)
+		}
+	}
+
+	if *output == "go" {
+		src, err := marshal.GenerateStructs(*pkg, *typeName, samples...)
+		if err != nil {
+			fmt.Fprintf(stderr, "rbmarshal: can not generate Go types: %v\n", err)
+			return exitUnsupported
+		}
+
+		stdout.Write(src)
+	}
+
+	return exitOK
+}
+
+var errUnknownEncoding = errors.New("unknown input encoding")
+
+// decodeInput strips whitespace from textual encodings, so that values
+// copied from a terminal or a database client can be pasted as they are.
+func decodeInput(raw []byte, encoding string) ([]byte, error) {
+	switch encoding {
+	case "raw":
+		return raw, nil
+	case "base64":
+		s := strings.Join(strings.Fields(string(raw)), "")
+		if data, err := base64.StdEncoding.DecodeString(s); err == nil {
+			return data, nil
+		}
+
+		return base64.URLEncoding.DecodeString(s)
+	case "hex":
+		s := strings.Join(strings.Fields(string(raw)), "")
+		s = strings.TrimPrefix(strings.TrimPrefix(s, "\\x"), "0x")
+
+		return hex.DecodeString(s)
+	}
+
+	return nil, errUnknownEncoding
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+type runTestCase struct {
+	Args     []string
+	Input    string
+	ExitCode int
+	Output   string
+}
+
+func TestRun(t *testing.T) {
+	// {:foo=>"bar", "n"=>1}
+	hash := "\x04\x08{\x07:\x08fooI\"\x08bar\x06:\x06ETI\"\x06n\x06;\x06Ti\x06"
+
+	tests := []runTestCase{
+		{[]string{}, hash, exitOK, "{:foo=>\"bar\", \"n\"=>1}\n"},
+		{[]string{"-out", "json"}, hash, exitOK, "{\"foo\":\"bar\",\"n\":1}\n"},
+		{[]string{"-in", "hex"}, "04 08 69 06\n", exitOK, "1\n"},
+		{[]string{"-in", "base64"}, "BAhpBg==\n", exitOK, "1\n"},
+		{[]string{}, "\x04\x08i\x06\x04\x08T", exitOK, "1\ntrue\n"},
+		{[]string{"-out", "annotate"}, "\x04\x08i\x06\x04\x08T", exitOK, ""},
+		{[]string{}, "\x04\x08[\x07i\x06", exitMalformed, ""},
+		{[]string{"-in", "hex"}, "0408zz", exitMalformed, ""},
+		{[]string{"-out", "json"}, "\x04\x08u:\x09Time\x06\x00", exitUnsupported, ""},
+		{[]string{"-out", "json"}, "\x04\x08[\x06@\x00", exitUnsupported, ""},
+		{[]string{"-max-depth", "1"}, "\x04\x08[\x06[\x00", exitLimitExceeded, ""},
+		{[]string{"-out", "go", "-type", "Prefs"}, hash, exitOK, "package main\n\ntype Prefs struct {\n\tFoo string `ruby:\"foo,symbol\"`\n\tN   int64  `ruby:\"n\"`\n}\n"},
+		{[]string{"-out", "go"}, "\x04\x08i\x06", exitUnsupported, ""},
+		{[]string{"-out", "xml"}, hash, exitError, ""},
+		{[]string{"-in", "rot13"}, hash, exitError, ""},
+	}
+
+	for _, testCase := range tests {
+		var stdout, stderr bytes.Buffer
+
+		code := run(testCase.Args, strings.NewReader(testCase.Input), &stdout, &stderr)
+		if code != testCase.ExitCode {
+			t.Errorf("run(%v) exited with %d instead of %d: %s", testCase.Args, code, testCase.ExitCode, stderr.String())
+		}
+
+		if testCase.Output != "" && stdout.String() != testCase.Output {
+			t.Errorf("run(%v) printed %q instead of %q", testCase.Args, stdout.String(), testCase.Output)
+		}
+	}
+}
+
+func TestRunAnnotateOffsets(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	if code := run([]string{"-out", "annotate"}, strings.NewReader("\x04\x08i\x06\x04\x08T"), &stdout, &stderr); code != exitOK {
+		t.Fatalf("run() exited with %d: %s", code, stderr.String())
+	}
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("run() printed %d lines instead of 4:\n%s", len(lines), stdout.String())
+	}
+
+	if !strings.HasPrefix(lines[2], "00000004") || !strings.HasPrefix(lines[3], "00000006") {
+		t.Errorf("run() printed wrong offsets for the second dump:\n%s", stdout.String())
+	}
+}
@@ -0,0 +1,133 @@
+package marshal
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// An Annotation describes the byte range of a single value in a dump.
+type Annotation struct {
+	Offset int    // position of the first byte of the value within the dump
+	Bytes  []byte // bytes of the value, including nested values
+	Depth  int    // nesting level, 0 for the version header and the top-level value
+	Type   byte   // type byte, e.g. '[' for an array, 0 for the version header
+
+	Symbol int // index in the symbol table defined or referenced by the value, -1 if none
+	Object int // index in the object table defined or referenced by the value, -1 if none
+
+	Value      string // decoded value, a summary for containers
+	Incomplete bool   // decoding stopped inside of this value
+}
+
+// Annotate lists every value of a dump in the order of appearance, starting
+// with the version header. If the dump is malformed, the annotations up to
+// the failure are returned along with the error; the last incomplete one
+// points to where decoding went wrong.
+func Annotate(data []byte) ([]Annotation, error) {
+	if len(data) < 2 {
+		return nil, IncompleteData
+	}
+
+	s := &scanner{data: data, pos: 2, record: true, annotate: true}
+	s.annotations = append(s.annotations, Annotation{
+		Bytes:  data[:2],
+		Symbol: -1,
+		Object: -1,
+		Value:  fmt.Sprintf("Marshal %d.%d", data[0], data[1]),
+	})
+	s.marks = append(s.marks, annotationMark{})
+
+	err := s.value()
+
+	root := s.marshalledObject()
+	for i := range s.annotations[1:] {
+		a := &s.annotations[i+1]
+		if !a.Incomplete {
+			a.Value = root.child(a.Offset - 2).describe()
+		}
+	}
+
+	return s.annotations, err
+}
+
+// describe returns Inspect() for scalar values and a summary for values
+// that contain other values, as those are annotated separately.
+func (obj *MarshalledObject) describe() string {
+	if len(obj.data) == 0 || !obj.complete() {
+		return "#<incomplete>"
+	}
+
+	switch obj.data[0] {
+	case '@':
+		idx, _ := parseInt(obj.data[1:])
+		return fmt.Sprintf("link to object #%d", idx)
+	case '[':
+		count, _ := parseInt(obj.data[1:])
+		return fmt.Sprintf("Array, %d elements", count)
+	case '{', '}':
+		count, _ := parseInt(obj.data[1:])
+		if obj.data[0] == '}' {
+			return fmt.Sprintf("Hash with default, %d pairs", count)
+		}
+		return fmt.Sprintf("Hash, %d pairs", count)
+	case 'o', 'S', 'u', 'U', 'd':
+		name, _ := obj.child(1).GetAsString()
+		return fmt.Sprintf("%s, instance of %s", typeNames[obj.data[0]], name)
+	case 'e', 'C':
+		name, _ := obj.child(1).GetAsString()
+		return fmt.Sprintf("%s %s", typeNames[obj.data[0]], name)
+	case 'I':
+		if inner := obj.child(1); inner.data[0] != '"' && inner.data[0] != ':' {
+			return "instance variables of the following value"
+		}
+	}
+
+	return obj.Inspect()
+}
+
+var typeNames = map[byte]string{
+	'o': "Object",
+	'S': "Struct",
+	'u': "user-defined _dump",
+	'U': "user-defined marshal_dump",
+	'd': "Data",
+	'e': "extended by",
+	'C': "subclass",
+}
+
+// String formats the annotation as a line of an annotated hex dump.
+func (a Annotation) String() string {
+	var hex bytes.Buffer
+	for i, b := range a.Bytes {
+		if i == 8 {
+			hex.WriteString("..")
+			break
+		}
+		fmt.Fprintf(&hex, "%02x ", b)
+	}
+
+	typ := "--"
+	if a.Type != 0 {
+		typ = string(a.Type)
+	}
+
+	var ref string
+	switch {
+	case a.Type == ';':
+		ref = fmt.Sprintf("sym ->%d", a.Symbol)
+	case a.Type == '@':
+		ref = fmt.Sprintf("obj ->%d", a.Object)
+	case a.Symbol >= 0:
+		ref = fmt.Sprintf("sym #%d", a.Symbol)
+	case a.Object >= 0:
+		ref = fmt.Sprintf("obj #%d", a.Object)
+	}
+
+	value := a.Value
+	if a.Incomplete {
+		value = "incomplete"
+	}
+
+	return fmt.Sprintf("%08x %6d  %-26s %s%-2s %-9s %s", a.Offset, len(a.Bytes), hex.String(), strings.Repeat("  ", a.Depth), typ, ref, value)
+}
@@ -0,0 +1,68 @@
+package marshal
+
+import (
+	"testing"
+)
+
+type annotateTestCase struct {
+	Offset int
+	Type   byte
+	Depth  int
+	Symbol int
+	Object int
+	Value  string
+}
+
+func TestAnnotate(t *testing.T) {
+	// x = "x"; [x, x]
+	annotations, err := Annotate([]byte{4, 8, 91, 7, 73, 34, 6, 120, 6, 58, 6, 69, 84, 64, 6})
+	if err != nil {
+		t.Fatalf("Annotate() returned an error: %v", err)
+	}
+
+	tests := []annotateTestCase{
+		{0, 0, 0, -1, -1, "Marshal 4.8"},
+		{2, '[', 0, -1, 0, "Array, 2 elements"},
+		{4, 'I', 1, -1, 1, `"x"`},
+		{5, '"', 2, -1, 1, `"x"`},
+		{9, ':', 2, 0, -1, ":E"},
+		{12, 'T', 2, -1, -1, "true"},
+		{13, '@', 1, -1, 1, "link to object #1"},
+	}
+
+	if len(annotations) != len(tests) {
+		t.Fatalf("Annotate() returned %d annotations instead of %d: %v", len(annotations), len(tests), annotations)
+	}
+
+	for i, testCase := range tests {
+		a := annotations[i]
+		if a.Offset != testCase.Offset || a.Type != testCase.Type || a.Depth != testCase.Depth || a.Symbol != testCase.Symbol || a.Object != testCase.Object || a.Value != testCase.Value || a.Incomplete {
+			t.Errorf("Annotate() returned %+v instead of %+v for annotation #%d", a, testCase, i)
+		}
+	}
+}
+
+func TestAnnotateMalformed(t *testing.T) {
+	annotations, err := Annotate([]byte{4, 8, 91, 7, 105, 6, 73, 34, 10, 120})
+	if err != IncompleteData {
+		t.Errorf("Annotate() returned '%v' instead of '%v'", err, IncompleteData)
+	}
+
+	if len(annotations) != 5 {
+		t.Fatalf("Annotate() returned %d annotations instead of 5: %v", len(annotations), annotations)
+	}
+
+	if a := annotations[2]; a.Incomplete || a.Value != "1" {
+		t.Errorf("Annotate() returned %+v for the complete element", a)
+	}
+
+	for _, i := range []int{1, 3, 4} {
+		if !annotations[i].Incomplete {
+			t.Errorf("Annotate() did not mark annotation #%d as incomplete: %+v", i, annotations[i])
+		}
+	}
+
+	if a := annotations[4]; a.Offset != 7 || a.Type != '"' {
+		t.Errorf("Annotate() returned %+v as the failing value", a)
+	}
+}
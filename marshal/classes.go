@@ -0,0 +1,91 @@
+package marshal
+
+// GetAsSet returns the elements of a Ruby Set in the order they were dumped.
+// Both the object form holding a @hash and the marshal_dump form of newer
+// Rubies are supported.
+func (obj *MarshalledObject) GetAsSet() (value []*MarshalledObject, err error) {
+	elements, err := obj.classValue("Set", "@hash")
+	if err != nil {
+		return
+	}
+
+	elements = elements.unwrap()
+
+	switch elements.GetType() {
+	case TYPE_ARRAY:
+		return elements.GetAsArray()
+	case TYPE_MAP:
+		count, offset := parseInt(elements.data[1:])
+		value, _, _ = elements.pairs(offset+1, count)
+
+		return value, nil
+	}
+
+	return nil, MalformedData
+}
+
+// GetAsRange returns the bounds of a Ruby Range. Begin or end are nil
+// values for beginless and endless ranges.
+func (obj *MarshalledObject) GetAsRange() (begin, end *MarshalledObject, exclusive bool, err error) {
+	obj = obj.unwrap()
+
+	if class, _ := obj.GetClassName(); class != "Range" || obj.data[0] != 'o' {
+		return nil, nil, false, TypeMismatch
+	}
+
+	ivars, _ := obj.GetAsObject()
+
+	begin, end, excl := ivars["begin"], ivars["end"], ivars["excl"]
+	if begin == nil || end == nil || excl == nil {
+		return nil, nil, false, MalformedData
+	}
+
+	exclusive, err = excl.GetAsBool()
+	if err != nil {
+		return nil, nil, false, MalformedData
+	}
+
+	return begin, end, exclusive, nil
+}
+
+// GetAsOpenStruct returns the attributes of a Ruby OpenStruct keyed by their
+// names.
+func (obj *MarshalledObject) GetAsOpenStruct() (value map[string]*MarshalledObject, err error) {
+	table, err := obj.classValue("OpenStruct", "@table")
+	if err != nil {
+		return
+	}
+
+	value, err = table.GetAsMap()
+	if err != nil {
+		return nil, MalformedData
+	}
+
+	return
+}
+
+// classValue returns the dumped value of a user-marshalled instance of
+// class, or its instance variable ivar if it is dumped as a plain object.
+func (obj *MarshalledObject) classValue(class, ivar string) (*MarshalledObject, error) {
+	obj = obj.unwrap()
+
+	if len(obj.data) == 0 || obj.data[0] != 'o' && obj.data[0] != 'U' {
+		return nil, TypeMismatch
+	}
+
+	name, _ := obj.child(1).GetAsString()
+	if name != class {
+		return nil, TypeMismatch
+	}
+
+	if obj.data[0] == 'U' {
+		return obj.child(1 + obj.child(1).getSize()), nil
+	}
+
+	ivars, _ := obj.GetAsObject()
+	if ivars[ivar] == nil {
+		return nil, MalformedData
+	}
+
+	return ivars[ivar], nil
+}
@@ -0,0 +1,124 @@
+package marshal
+
+import (
+	"reflect"
+	"testing"
+)
+
+var (
+	setData         = []byte{4, 8, 111, 58, 8, 83, 101, 116, 6, 58, 10, 64, 104, 97, 115, 104, 125, 7, 105, 6, 84, 105, 7, 84, 70} // Set[1, 2]
+	userSetData     = []byte{4, 8, 85, 58, 8, 83, 101, 116, 91, 7, 105, 6, 105, 7}
+	rangeData       = []byte{4, 8, 111, 58, 10, 82, 97, 110, 103, 101, 8, 58, 9, 101, 120, 99, 108, 84, 58, 10, 98, 101, 103, 105, 110, 105, 6, 58, 8, 101, 110, 100, 105, 8} // 1...3
+	endlessData     = []byte{4, 8, 111, 58, 10, 82, 97, 110, 103, 101, 8, 58, 9, 101, 120, 99, 108, 70, 58, 10, 98, 101, 103, 105, 110, 105, 6, 58, 8, 101, 110, 100, 48}     // 1..
+	openStructData  = []byte{4, 8, 85, 58, 15, 79, 112, 101, 110, 83, 116, 114, 117, 99, 116, 123, 6, 58, 6, 97, 105, 6}                                                      // OpenStruct.new(a: 1)
+	tableStructData = []byte{4, 8, 111, 58, 15, 79, 112, 101, 110, 83, 116, 114, 117, 99, 116, 6, 58, 11, 64, 116, 97, 98, 108, 101, 123, 6, 58, 6, 97, 105, 6}
+)
+
+type getAsSetTestCase struct {
+	Data        []byte
+	Expectation []int64
+	Error       error
+}
+
+func TestGetAsSet(t *testing.T) {
+	tests := []getAsSetTestCase{
+		{setData, []int64{1, 2}, nil},
+		{userSetData, []int64{1, 2}, nil},
+		{[]byte{4, 8, 91, 7, 105, 6, 105, 7}, nil, TypeMismatch},
+		{moneyData, nil, TypeMismatch},
+		{[]byte{4, 8, 111, 58, 8, 83, 101, 116, 0}, nil, MalformedData},
+	}
+
+	for _, testCase := range tests {
+		value, err := CreateMarshalledObject(testCase.Data).GetAsSet()
+		if err != testCase.Error {
+			t.Errorf("GetAsSet() returned error %v instead of %v", err, testCase.Error)
+			continue
+		}
+
+		var elements []int64
+		for _, v := range value {
+			i, _ := v.GetAsInteger()
+			elements = append(elements, i)
+		}
+
+		if !reflect.DeepEqual(elements, testCase.Expectation) {
+			t.Errorf("GetAsSet() returned %v instead of %v", elements, testCase.Expectation)
+		}
+	}
+}
+
+type getAsRangeTestCase struct {
+	Data      []byte
+	Begin     string
+	End       string
+	Exclusive bool
+	Error     error
+}
+
+func TestGetAsRange(t *testing.T) {
+	tests := []getAsRangeTestCase{
+		{rangeData, "1", "3", true, nil},
+		{endlessData, "1", "nil", false, nil},
+		{setData, "", "", false, TypeMismatch},
+		{[]byte{4, 8, 111, 58, 10, 82, 97, 110, 103, 101, 0}, "", "", false, MalformedData},
+	}
+
+	for _, testCase := range tests {
+		begin, end, exclusive, err := CreateMarshalledObject(testCase.Data).GetAsRange()
+		if err != testCase.Error {
+			t.Errorf("GetAsRange() returned error %v instead of %v", err, testCase.Error)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		if begin.Inspect() != testCase.Begin || end.Inspect() != testCase.End || exclusive != testCase.Exclusive {
+			t.Errorf("GetAsRange() returned %v, %v, %v instead of %v, %v, %v", begin.Inspect(), end.Inspect(), exclusive, testCase.Begin, testCase.End, testCase.Exclusive)
+		}
+	}
+}
+
+func TestGetAsOpenStruct(t *testing.T) {
+	for _, data := range [][]byte{openStructData, tableStructData} {
+		value, err := CreateMarshalledObject(data).GetAsOpenStruct()
+		if err != nil {
+			t.Errorf("GetAsOpenStruct() returned error %v", err)
+			continue
+		}
+
+		if len(value) != 1 || value["a"] == nil || value["a"].ToString() != "1" {
+			t.Errorf("GetAsOpenStruct() returned %v instead of {a: 1}", value)
+		}
+	}
+
+	if _, err := CreateMarshalledObject(setData).GetAsOpenStruct(); err != TypeMismatch {
+		t.Errorf("GetAsOpenStruct() returned error %v instead of %v", err, TypeMismatch)
+	}
+}
+
+func TestUnmarshalClasses(t *testing.T) {
+	var set []int
+	if err := Unmarshal(setData, &set); err != nil || !reflect.DeepEqual(set, []int{1, 2}) {
+		t.Errorf("Unmarshal() decoded %v, %v instead of [1 2]", set, err)
+	}
+
+	var attributes map[string]int
+	if err := Unmarshal(openStructData, &attributes); err != nil || !reflect.DeepEqual(attributes, map[string]int{"a": 1}) {
+		t.Errorf("Unmarshal() decoded %v, %v instead of map[a:1]", attributes, err)
+	}
+
+	var r struct {
+		Begin, End int
+		Excl       bool
+	}
+	if err := Unmarshal(rangeData, &r); err != nil || r.Begin != 1 || r.End != 3 || !r.Excl {
+		t.Errorf("Unmarshal() decoded %+v, %v instead of 1...3", r, err)
+	}
+
+	var value interface{}
+	if err := Unmarshal(userSetData, &value); err != nil || !reflect.DeepEqual(value, []interface{}{int64(1), int64(2)}) {
+		t.Errorf("Unmarshal() decoded %v, %v instead of [1 2]", value, err)
+	}
+}
@@ -0,0 +1,66 @@
+package marshal
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+var LimitExceeded = errors.New("gorails/marshal: decode limit exceeded")
+
+const (
+	majorVersion = 4
+	minorVersion = 8
+)
+
+// A Decoder reads consecutive Marshal dumps from an input stream.
+type Decoder struct {
+	// MaxSize limits the size of a single dump in bytes and MaxDepth the
+	// nesting of values within it. Decode returns LimitExceeded for dumps
+	// exceeding either limit. Zero means no limit.
+	MaxSize  int
+	MaxDepth int
+
+	r   *bufio.Reader
+	err error
+}
+
+// NewDecoder returns a new decoder that reads from r.
+//
+// The decoder introduces its own buffering and may read data from r beyond
+// the dumps requested.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r)}
+}
+
+// Decode reads the next complete dump, including its version header, from
+// the input. It returns io.EOF when the input ends on a dump boundary and
+// IncompleteData when it ends in the middle of a dump.
+func (d *Decoder) Decode() (*MarshalledObject, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	if _, err := d.r.Peek(1); err != nil {
+		d.err = err
+		return nil, err
+	}
+
+	s := &scanner{src: d.r, record: true, maxSize: d.MaxSize, maxDepth: d.MaxDepth}
+
+	if err := s.need(2); err != nil {
+		d.err = err
+		return nil, err
+	}
+	if s.data[0] != majorVersion || s.data[1] > minorVersion {
+		d.err = UnsupportedVersion
+		return nil, d.err
+	}
+
+	if err := s.dump(); err != nil {
+		d.err = err
+		return nil, err
+	}
+
+	return s.marshalledObject(), nil
+}
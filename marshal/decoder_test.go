@@ -0,0 +1,113 @@
+package marshal
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+func TestDecoderDecode(t *testing.T) {
+	var stream []byte
+	stream = append(stream, 4, 8, 105, 6)                                                                 // 1
+	stream = append(stream, 4, 8, 91, 8, 105, 6, 73, 34, 6, 120, 6, 58, 6, 69, 84, 64, 6)                 // x = "x"; [1, x, x]
+	stream = append(stream, 4, 8, 123, 6, 58, 8, 102, 111, 111, 73, 34, 8, 98, 97, 114, 6, 58, 6, 69, 84) // {foo: "bar"}
+
+	d := NewDecoder(iotest.OneByteReader(bytes.NewReader(stream)))
+
+	obj, err := d.Decode()
+	if err != nil {
+		t.Fatalf("Decode() returned an error for the first dump: %v", err)
+	}
+	if i, err := obj.GetAsInteger(); err != nil || i != 1 {
+		t.Errorf("Decode() returned %v (%v) instead of 1 for the first dump", i, err)
+	}
+
+	obj, err = d.Decode()
+	if err != nil {
+		t.Fatalf("Decode() returned an error for the second dump: %v", err)
+	}
+	arr, err := obj.GetAsArray()
+	if err != nil || len(arr) != 3 {
+		t.Fatalf("Decode() returned %v (%v) instead of a 3 element array for the second dump", arr, err)
+	}
+	for _, i := range []int{1, 2} {
+		if s, err := arr[i].GetAsString(); err != nil || s != "x" {
+			t.Errorf("element #%d of the second dump is '%v' (%v) instead of 'x'", i, s, err)
+		}
+	}
+
+	obj, err = d.Decode()
+	if err != nil {
+		t.Fatalf("Decode() returned an error for the third dump: %v", err)
+	}
+	m, err := obj.GetAsMap()
+	if err != nil {
+		t.Fatalf("Decode() returned an error for the third dump: %v", err)
+	}
+	if s, _ := m["foo"].GetAsString(); s != "bar" {
+		t.Errorf("Decode() returned '%v' instead of 'bar' for the third dump", s)
+	}
+
+	if _, err = d.Decode(); err != io.EOF {
+		t.Errorf("Decode() returned %v instead of io.EOF at the end of the stream", err)
+	}
+}
+
+type decoderErrorTestCase struct {
+	Data        []byte
+	Expectation error
+}
+
+func TestDecoderDecodeErrors(t *testing.T) {
+	tests := []decoderErrorTestCase{
+		{[]byte{}, io.EOF},
+		{[]byte{4}, IncompleteData},
+		{[]byte{4, 8}, IncompleteData},
+		{[]byte{4, 8, 91, 7, 105}, IncompleteData},
+		{[]byte{4, 8, 73, 34, 10, 120}, IncompleteData},
+		{[]byte{3, 0, 48}, UnsupportedVersion},
+		{[]byte{4, 8, 64, 6}, MalformedData},
+		{[]byte{4, 8, 59, 0}, MalformedData},
+		{[]byte{4, 8, 122}, MalformedData},
+	}
+
+	for _, testCase := range tests {
+		d := NewDecoder(bytes.NewReader(testCase.Data))
+
+		if _, err := d.Decode(); err != testCase.Expectation {
+			t.Errorf("Decode() returned '%v' instead of '%v' for %v", err, testCase.Expectation, testCase.Data)
+		}
+
+		if _, err := d.Decode(); err != testCase.Expectation {
+			t.Errorf("Decode() did not return '%v' again after a failure for %v", testCase.Expectation, testCase.Data)
+		}
+	}
+}
+
+type decoderLimitTestCase struct {
+	Data        []byte
+	MaxSize     int
+	MaxDepth    int
+	Expectation error
+}
+
+func TestDecoderLimits(t *testing.T) {
+	tests := []decoderLimitTestCase{
+		{[]byte{4, 8, 91, 6, 91, 6, 91, 0}, 0, 3, nil},
+		{[]byte{4, 8, 91, 6, 91, 6, 91, 0}, 0, 2, LimitExceeded},
+		{[]byte{4, 8, 91, 6, 91, 6, 91, 0}, 8, 0, nil},
+		{[]byte{4, 8, 91, 6, 91, 6, 91, 0}, 7, 0, LimitExceeded},
+		{[]byte{4, 8, 34, 3, 0, 0, 1}, 1024, 0, LimitExceeded},
+	}
+
+	for _, testCase := range tests {
+		d := NewDecoder(bytes.NewReader(testCase.Data))
+		d.MaxSize = testCase.MaxSize
+		d.MaxDepth = testCase.MaxDepth
+
+		if _, err := d.Decode(); err != testCase.Expectation {
+			t.Errorf("Decode() returned '%v' instead of '%v' for %v with limits %d/%d", err, testCase.Expectation, testCase.Data, testCase.MaxSize, testCase.MaxDepth)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package marshal
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/big"
+)
+
+type DifferenceKind byte
+
+const (
+	DIFF_TYPE    DifferenceKind = 1 // the values have different types or classes
+	DIFF_VALUE   DifferenceKind = 2 // the values have the same type but differ
+	DIFF_MISSING DifferenceKind = 3 // the key or index exists in a only
+	DIFF_ADDED   DifferenceKind = 4 // the key or index exists in b only
+)
+
+// A Difference is a single semantic difference between two values.
+type Difference struct {
+	// Path addresses the value within the compared objects, e.g.
+	// ["warden.user.user.key"][0][0] or [:user].@name. It is empty for the
+	// top-level value.
+	Path string
+	Kind DifferenceKind
+	// A and B are the differing values, nil if missing on that side.
+	A, B *MarshalledObject
+}
+
+func (d Difference) String() string {
+	path := d.Path
+	if path == "" {
+		path = "(root)"
+	}
+
+	switch d.Kind {
+	case DIFF_TYPE:
+		return fmt.Sprintf("%s: type changed from %s to %s", path, d.A.unwrap().rubyClass(), d.B.unwrap().rubyClass())
+	case DIFF_VALUE:
+		return fmt.Sprintf("%s: value changed from %s to %s", path, d.A.Inspect(), d.B.Inspect())
+	case DIFF_MISSING:
+		return fmt.Sprintf("%s: missing, was %s", path, d.A.Inspect())
+	case DIFF_ADDED:
+		return fmt.Sprintf("%s: added %s", path, d.B.Inspect())
+	}
+
+	return path
+}
+
+// Equal reports whether a and b represent the same Ruby value. Object links
+// are resolved and the symbol and object table layout is ignored, as are
+// string encodings and modules an object has been extended with.
+func Equal(a, b *MarshalledObject) bool {
+	return len(Diff(a, b)) == 0
+}
+
+// Diff returns the semantic differences between a and b, see Equal. Hash
+// entries are matched by key, array elements by index.
+func Diff(a, b *MarshalledObject) []Difference {
+	d := &differ{seen: make(map[[2]*byte]bool)}
+	d.compare("", a, b)
+
+	return d.diffs
+}
+
+type differ struct {
+	diffs []Difference
+	seen  map[[2]*byte]bool
+}
+
+func (d *differ) add(path string, kind DifferenceKind, a, b *MarshalledObject) {
+	d.diffs = append(d.diffs, Difference{path, kind, a, b})
+}
+
+func (d *differ) compare(path string, a, b *MarshalledObject) {
+	a, b = a.unwrap(), b.unwrap()
+
+	ca, cb := a.rubyClass(), b.rubyClass()
+	if ca != cb {
+		if ca == "TrueClass" && cb == "FalseClass" || ca == "FalseClass" && cb == "TrueClass" {
+			d.add(path, DIFF_VALUE, a, b)
+		} else {
+			d.add(path, DIFF_TYPE, a, b)
+		}
+		return
+	}
+
+	if len(a.data) == 0 {
+		return
+	}
+
+	// Values can only be reached recursively through containers, and a
+	// recursive structure is equal to itself from here on.
+	switch a.data[0] {
+	case '[', '{', '}', 'o', 'S', 'U', 'd', 'C':
+		key := [2]*byte{&a.data[0], &b.data[0]}
+		if d.seen[key] {
+			return
+		}
+		d.seen[key] = true
+	}
+
+	switch a.data[0] {
+	case 'i', 'l':
+		if a.bigInteger().Cmp(b.bigInteger()) != 0 {
+			d.add(path, DIFF_VALUE, a, b)
+		}
+	case 'f':
+		fa, _ := a.GetAsFloat()
+		fb, _ := b.GetAsFloat()
+
+		if fa != fb && !(math.IsNaN(fa) && math.IsNaN(fb)) {
+			d.add(path, DIFF_VALUE, a, b)
+		}
+	case '"', ':', ';':
+		sa, _ := a.GetAsString()
+		sb, _ := b.GetAsString()
+
+		if sa != sb {
+			d.add(path, DIFF_VALUE, a, b)
+		}
+	case '[':
+		va, _ := a.GetAsArray()
+		vb, _ := b.GetAsArray()
+
+		for i := 0; i < len(va) || i < len(vb); i++ {
+			p := fmt.Sprintf("%s[%d]", path, i)
+
+			switch {
+			case i >= len(vb):
+				d.add(p, DIFF_MISSING, va[i], nil)
+			case i >= len(va):
+				d.add(p, DIFF_ADDED, nil, vb[i])
+			default:
+				d.compare(p, va[i], vb[i])
+			}
+		}
+	case '{', '}':
+		d.comparePairs(path, a.hashPairs(), b.hashPairs(), "[%s]")
+	case 'o', 'S':
+		d.comparePairs(path, a.objectPairs(), b.objectPairs(), ".%s")
+	case 'U', 'd', 'C':
+		d.compare(path, a.child(1+a.child(1).getSize()), b.child(1+b.child(1).getSize()))
+	case 'u':
+		va, _ := parseString(a.data[1+a.child(1).getSize():])
+		vb, _ := parseString(b.data[1+b.child(1).getSize():])
+
+		if va != vb {
+			d.add(path, DIFF_VALUE, a, b)
+		}
+	default:
+		// Regexps, classes and modules do not reference symbols or objects
+		// and compare by their bytes.
+		if !bytes.Equal(a.data[:a.getSize()], b.data[:b.getSize()]) {
+			d.add(path, DIFF_VALUE, a, b)
+		}
+	}
+}
+
+type pair struct {
+	name  string
+	key   *MarshalledObject
+	value *MarshalledObject
+}
+
+func (d *differ) comparePairs(path string, pa, pb []pair, format string) {
+	index := make(map[string]int, len(pb))
+	for i, p := range pb {
+		index[p.name] = i
+	}
+
+	matched := make(map[string]bool, len(pa))
+	for _, p := range pa {
+		matched[p.name] = true
+
+		if i, ok := index[p.name]; ok {
+			d.compare(path+fmt.Sprintf(format, p.name), p.value, pb[i].value)
+		} else {
+			d.add(path+fmt.Sprintf(format, p.name), DIFF_MISSING, p.value, nil)
+		}
+	}
+
+	for _, p := range pb {
+		if !matched[p.name] {
+			d.add(path+fmt.Sprintf(format, p.name), DIFF_ADDED, nil, p.value)
+		}
+	}
+}
+
+// hashPairs returns the entries of a hash named by the inspected keys, so
+// that :foo and "foo" are told apart.
+func (obj *MarshalledObject) hashPairs() []pair {
+	count, offset := parseInt(obj.data[1:])
+	keys, values, _ := obj.pairs(offset+1, count)
+
+	result := make([]pair, len(keys))
+	for i, k := range keys {
+		result[i] = pair{k.Inspect(), k, values[i]}
+	}
+
+	return result
+}
+
+func (obj *MarshalledObject) objectPairs() []pair {
+	offset := 1 + obj.child(1).getSize()
+	count, size := parseInt(obj.data[offset:])
+	keys, values, _ := obj.pairs(offset+size, count)
+
+	result := make([]pair, len(keys))
+	for i, k := range keys {
+		result[i] = pair{k.ToString(), k, values[i]}
+	}
+
+	return result
+}
+
+// unwrap resolves object links and strips instance variable wrappers and
+// extended modules, returning the underlying value.
+func (obj *MarshalledObject) unwrap() *MarshalledObject {
+	for {
+		if ref := obj.resolveObjectLink(); ref != nil {
+			obj = ref
+			continue
+		}
+
+		if len(obj.data) == 0 {
+			return obj
+		}
+
+		switch obj.data[0] {
+		case 'I':
+			obj = obj.child(1)
+		case 'e':
+			obj = obj.child(1 + obj.child(1).getSize())
+		default:
+			return obj
+		}
+	}
+}
+
+// rubyClass returns the name of the Ruby class of an unwrapped value.
+func (obj *MarshalledObject) rubyClass() string {
+	if len(obj.data) == 0 {
+		return ""
+	}
+
+	switch obj.data[0] {
+	case '0':
+		return "NilClass"
+	case 'T':
+		return "TrueClass"
+	case 'F':
+		return "FalseClass"
+	case 'i', 'l':
+		return "Integer"
+	case 'f':
+		return "Float"
+	case '"':
+		return "String"
+	case ':', ';':
+		return "Symbol"
+	case '[':
+		return "Array"
+	case '{', '}':
+		return "Hash"
+	case '/':
+		return "Regexp"
+	case 'c':
+		return "Class"
+	case 'm', 'M':
+		return "Module"
+	case 'o', 'S', 'u', 'U', 'd', 'C':
+		name, _ := obj.child(1).GetAsString()
+		return name
+	}
+
+	return ""
+}
+
+func (obj *MarshalledObject) bigInteger() *big.Int {
+	if obj.data[0] == 'l' {
+		return parseBigInt(obj.data[1:])
+	}
+
+	value, _ := parseInt(obj.data[1:])
+
+	return big.NewInt(value)
+}
@@ -0,0 +1,63 @@
+package marshal
+
+import (
+	"reflect"
+	"testing"
+)
+
+type diffTestCase struct {
+	A, B        []byte
+	Expectation []string
+}
+
+func TestDiff(t *testing.T) {
+	richMoneyData := append([]byte{}, moneyData[:19]...)
+	richMoneyData = append(richMoneyData, 105, 1, 200)
+	richMoneyData = append(richMoneyData, moneyData[21:]...)
+
+	tests := []diffTestCase{
+		// [:x, :x] with and without a symbol link
+		{[]byte{4, 8, 91, 7, 58, 6, 120, 59, 0}, []byte{4, 8, 91, 7, 58, 6, 120, 58, 6, 120}, nil},
+		// s = "a"; [s, s] and ["a", "a"]
+		{
+			[]byte{4, 8, 91, 7, 73, 34, 6, 97, 6, 58, 6, 69, 84, 64, 6},
+			[]byte{4, 8, 91, 7, 73, 34, 6, 97, 6, 58, 6, 69, 84, 73, 34, 6, 97, 6, 59, 0, 84},
+			nil,
+		},
+		// 1 as a fixnum and as a bignum
+		{[]byte{4, 8, 105, 6}, []byte{4, 8, 108, 43, 6, 1, 0}, nil},
+		// a = []; a << a
+		{[]byte{4, 8, 91, 6, 64, 0}, []byte{4, 8, 91, 6, 64, 0}, nil},
+		{moneyData, moneyData, nil},
+		{[]byte{4, 8, 84}, []byte{4, 8, 70}, []string{"(root): value changed from true to false"}},
+		{[]byte{4, 8, 91, 6, 105, 6}, []byte{4, 8, 91, 6, 34, 6, 49}, []string{"[0]: type changed from Integer to String"}},
+		{[]byte{4, 8, 91, 7, 105, 6, 105, 7}, []byte{4, 8, 91, 6, 105, 6}, []string{"[1]: missing, was 2"}},
+		{[]byte{4, 8, 91, 0}, []byte{4, 8, 91, 6, 105, 6}, []string{"[0]: added 1"}},
+		{
+			// {:foo=>"bar", "n"=>1} and {:foo=>"baz", :n=>1}
+			[]byte{4, 8, 123, 7, 58, 8, 102, 111, 111, 73, 34, 8, 98, 97, 114, 6, 58, 6, 69, 84, 73, 34, 6, 110, 6, 59, 6, 84, 105, 6},
+			[]byte{4, 8, 123, 7, 58, 8, 102, 111, 111, 73, 34, 8, 98, 97, 122, 6, 58, 6, 69, 84, 58, 6, 110, 105, 6},
+			[]string{
+				`[:foo]: value changed from "bar" to "baz"`,
+				`["n"]: missing, was 1`,
+				`[:n]: added 1`,
+			},
+		},
+		{moneyData, richMoneyData, []string{".@cents: value changed from 100 to 200"}},
+	}
+
+	for _, testCase := range tests {
+		var value []string
+		for _, d := range Diff(CreateMarshalledObject(testCase.A), CreateMarshalledObject(testCase.B)) {
+			value = append(value, d.String())
+		}
+
+		if !reflect.DeepEqual(value, testCase.Expectation) {
+			t.Errorf("Diff() returned %q instead of %q", value, testCase.Expectation)
+		}
+
+		if equal := Equal(CreateMarshalledObject(testCase.A), CreateMarshalledObject(testCase.B)); equal != (len(testCase.Expectation) == 0) {
+			t.Errorf("Equal() returned %v for %v and %v", equal, testCase.A, testCase.B)
+		}
+	}
+}
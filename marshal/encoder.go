@@ -0,0 +1,515 @@
+package marshal
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var UnsupportedValue = errors.New("gorails/marshal: value can not be represented in Ruby Marshal format")
+
+// RubyMarshaler is implemented by types that provide their own Ruby
+// representation. MarshalRuby returns a value which is encoded in place of
+// the receiver, typically an Object.
+type RubyMarshaler interface {
+	MarshalRuby() (interface{}, error)
+}
+
+// Symbol is encoded as a Ruby symbol instead of a string.
+type Symbol string
+
+// Object is encoded as an instance of Ruby class Class. Ivars are keyed by
+// instance variable names including the leading "@".
+type Object struct {
+	Class string
+	Ivars map[string]interface{}
+}
+
+// Pair is an entry of a Hash or a member of a Struct.
+type Pair struct {
+	Key   interface{}
+	Value interface{}
+}
+
+// Hash is encoded as a Ruby hash holding the pairs in order. Unlike a map it
+// may have keys of different types.
+type Hash []Pair
+
+// Struct is encoded as an instance of the Ruby Struct subclass Class.
+// Members are keyed by their names.
+type Struct struct {
+	Class   string
+	Members []Pair
+}
+
+// UserDefined is encoded as an instance of Class that was dumped by its
+// _dump method, e.g. a BigDecimal.
+type UserDefined struct {
+	Class string
+	Data  []byte
+}
+
+// UserMarshal is encoded as an instance of Class that was dumped by its
+// marshal_dump method, which returned Data.
+type UserMarshal struct {
+	Class string
+	Data  interface{}
+}
+
+// An Encoder writes Marshal dumps of Go values to an output stream.
+type Encoder struct {
+	w io.Writer
+}
+
+// NewEncoder returns a new encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// Encode writes a complete dump of v, including the version header.
+func (e *Encoder) Encode(v interface{}) error {
+	data, err := Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	_, err = e.w.Write(data)
+
+	return err
+}
+
+// Marshal returns the Ruby Marshal dump of v.
+//
+// Booleans, integers, floats and strings are encoded as the corresponding
+// Ruby values, slices and arrays as arrays, maps and structs as hashes.
+// Struct fields are keyed by the "ruby" struct tag, or by the field name if
+// the tag is missing. The tag options "omitempty" and "symbol" skip empty
+// fields and use a symbol as the hash key respectively. Nil pointers,
+// interfaces, slices and maps are encoded as nil.
+//
+// Symbol, Object, Hash, Struct, UserDefined and UserMarshal values are
+// encoded as the Ruby values they describe.
+func Marshal(v interface{}) ([]byte, error) {
+	e := &encodeState{symbols: make(map[string]int)}
+	e.WriteByte(majorVersion)
+	e.WriteByte(minorVersion)
+
+	if err := e.marshal(reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+
+	return e.Bytes(), nil
+}
+
+type encodeState struct {
+	bytes.Buffer
+	symbols map[string]int
+}
+
+var rubyMarshalerType = reflect.TypeOf((*RubyMarshaler)(nil)).Elem()
+
+func (e *encodeState) marshal(v reflect.Value) error {
+	if !v.IsValid() {
+		e.WriteByte('0')
+		return nil
+	}
+
+	if v.Kind() != reflect.Ptr && v.CanAddr() && reflect.PtrTo(v.Type()).Implements(rubyMarshalerType) {
+		v = v.Addr()
+	}
+
+	if v.Type().Implements(rubyMarshalerType) {
+		if v.Kind() == reflect.Ptr && v.IsNil() {
+			e.WriteByte('0')
+			return nil
+		}
+
+		r, err := v.Interface().(RubyMarshaler).MarshalRuby()
+		if err != nil {
+			return err
+		}
+
+		return e.marshal(reflect.ValueOf(r))
+	}
+
+	switch x := v.Interface().(type) {
+	case Symbol:
+		e.writeSymbol(string(x))
+		return nil
+	case Object:
+		return e.marshalObject(x)
+	case Hash:
+		e.WriteByte('{')
+		return e.marshalPairs(x)
+	case Struct:
+		for _, m := range x.Members {
+			if _, ok := m.Key.(string); !ok {
+				return UnsupportedValue
+			}
+		}
+
+		e.WriteByte('S')
+		e.writeSymbol(x.Class)
+
+		members := make(Hash, len(x.Members))
+		for i, m := range x.Members {
+			members[i] = Pair{Symbol(m.Key.(string)), m.Value}
+		}
+
+		return e.marshalPairs(members)
+	case UserDefined:
+		e.WriteByte('u')
+		e.writeSymbol(x.Class)
+		e.writeBytes(x.Data)
+		return nil
+	case UserMarshal:
+		e.WriteByte('U')
+		e.writeSymbol(x.Class)
+		return e.marshal(reflect.ValueOf(x.Data))
+	case *MarshalledObject:
+		if x != nil {
+			return UnsupportedValue
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			e.WriteByte('T')
+		} else {
+			e.WriteByte('F')
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.writeInteger(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > math.MaxInt64 {
+			return UnsupportedValue
+		}
+		e.writeInteger(int64(v.Uint()))
+	case reflect.Float32, reflect.Float64:
+		e.writeFloat(v.Float())
+	case reflect.String:
+		e.writeString(v.String())
+	case reflect.Slice:
+		if v.IsNil() {
+			e.WriteByte('0')
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			e.WriteByte('"')
+			e.writeBytes(v.Bytes())
+			return nil
+		}
+		fallthrough
+	case reflect.Array:
+		e.WriteByte('[')
+		e.writeLong(int64(v.Len()))
+		for i := 0; i < v.Len(); i++ {
+			if err := e.marshal(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			e.WriteByte('0')
+			return nil
+		}
+		return e.marshalMap(v)
+	case reflect.Struct:
+		return e.marshalStruct(v)
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			e.WriteByte('0')
+			return nil
+		}
+		return e.marshal(v.Elem())
+	default:
+		return UnsupportedValue
+	}
+
+	return nil
+}
+
+func (e *encodeState) marshalMap(v reflect.Value) error {
+	keys := v.MapKeys()
+	sort.Sort(byKey(keys))
+
+	e.WriteByte('{')
+	e.writeLong(int64(len(keys)))
+	for _, k := range keys {
+		if err := e.marshal(k); err != nil {
+			return err
+		}
+		if err := e.marshal(v.MapIndex(k)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *encodeState) marshalStruct(v reflect.Value) error {
+	fields := structFields(v.Type())
+
+	encoded := make([]field, 0, len(fields))
+	for _, f := range fields {
+		if f.omitEmpty && isEmptyValue(v.Field(f.index)) {
+			continue
+		}
+		encoded = append(encoded, f)
+	}
+
+	e.WriteByte('{')
+	e.writeLong(int64(len(encoded)))
+	for _, f := range encoded {
+		if f.symbol {
+			e.writeSymbol(f.name)
+		} else {
+			e.writeString(f.name)
+		}
+
+		if err := e.marshal(v.Field(f.index)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *encodeState) marshalPairs(pairs Hash) error {
+	e.writeLong(int64(len(pairs)))
+	for _, p := range pairs {
+		if err := e.marshal(reflect.ValueOf(p.Key)); err != nil {
+			return err
+		}
+		if err := e.marshal(reflect.ValueOf(p.Value)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *encodeState) marshalObject(o Object) error {
+	names := make([]string, 0, len(o.Ivars))
+	for name := range o.Ivars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	e.WriteByte('o')
+	e.writeSymbol(o.Class)
+	e.writeLong(int64(len(names)))
+	for _, name := range names {
+		e.writeSymbol(name)
+		if err := e.marshal(reflect.ValueOf(o.Ivars[name])); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Ruby dumps integers outside of the 31-bit fixnum range as bignums.
+func (e *encodeState) writeInteger(i int64) {
+	if i >= -(1<<30) && i < 1<<30 {
+		e.WriteByte('i')
+		e.writeLong(i)
+		return
+	}
+
+	e.WriteByte('l')
+
+	u := uint64(i)
+	if i < 0 {
+		e.WriteByte('-')
+		u = uint64(-i)
+	} else {
+		e.WriteByte('+')
+	}
+
+	var magnitude []byte
+	for ; u > 0; u >>= 8 {
+		magnitude = append(magnitude, byte(u))
+	}
+	if len(magnitude)%2 == 1 {
+		magnitude = append(magnitude, 0)
+	}
+
+	e.writeLong(int64(len(magnitude) / 2))
+	e.Write(magnitude)
+}
+
+func (e *encodeState) writeLong(i int64) {
+	switch {
+	case i == 0:
+		e.WriteByte(0)
+	case i > 0 && i < 123:
+		e.WriteByte(byte(i + 5))
+	case i < 0 && i > -124:
+		e.WriteByte(byte(i - 5))
+	default:
+		var buf [9]byte
+		for n := 1; n < len(buf); n++ {
+			buf[n] = byte(i)
+			i >>= 8
+
+			if i == 0 {
+				buf[0] = byte(n)
+				e.Write(buf[:n+1])
+				return
+			}
+			if i == -1 {
+				buf[0] = byte(-n)
+				e.Write(buf[:n+1])
+				return
+			}
+		}
+	}
+}
+
+func (e *encodeState) writeFloat(f float64) {
+	var s string
+	switch {
+	case math.IsInf(f, 1):
+		s = "inf"
+	case math.IsInf(f, -1):
+		s = "-inf"
+	case math.IsNaN(f):
+		s = "nan"
+	default:
+		s = strconv.FormatFloat(f, 'g', -1, 64)
+	}
+
+	e.WriteByte('f')
+	e.writeBytes([]byte(s))
+}
+
+// Strings that are valid UTF-8 are tagged with the UTF-8 encoding, others
+// are dumped as binary.
+func (e *encodeState) writeString(s string) {
+	if !utf8.ValidString(s) {
+		e.WriteByte('"')
+		e.writeBytes([]byte(s))
+		return
+	}
+
+	e.WriteByte('I')
+	e.WriteByte('"')
+	e.writeBytes([]byte(s))
+	e.writeLong(1)
+	e.writeSymbol("E")
+	e.WriteByte('T')
+}
+
+func (e *encodeState) writeSymbol(s string) {
+	if idx, ok := e.symbols[s]; ok {
+		e.WriteByte(';')
+		e.writeLong(int64(idx))
+		return
+	}
+
+	e.symbols[s] = len(e.symbols)
+	e.WriteByte(':')
+	e.writeBytes([]byte(s))
+}
+
+func (e *encodeState) writeBytes(b []byte) {
+	e.writeLong(int64(len(b)))
+	e.Write(b)
+}
+
+type field struct {
+	name      string
+	index     int
+	omitEmpty bool
+	symbol    bool
+}
+
+// structFields returns the exported fields of t that are not tagged "-".
+func structFields(t reflect.Type) []field {
+	var fields []field
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		tag := sf.Tag.Get("ruby")
+		if tag == "-" {
+			continue
+		}
+
+		f := field{name: sf.Name, index: i}
+
+		options := strings.Split(tag, ",")
+		if options[0] != "" {
+			f.name = options[0]
+		}
+		for _, option := range options[1:] {
+			switch option {
+			case "omitempty":
+				f.omitEmpty = true
+			case "symbol":
+				f.symbol = true
+			}
+		}
+
+		fields = append(fields, f)
+	}
+
+	return fields
+}
+
+type byKey []reflect.Value
+
+func (k byKey) Len() int      { return len(k) }
+func (k byKey) Swap(i, j int) { k[i], k[j] = k[j], k[i] }
+func (k byKey) Less(i, j int) bool {
+	a, b := k[i], k[j]
+	if a.Kind() == reflect.Interface {
+		a = a.Elem()
+	}
+	if b.Kind() == reflect.Interface {
+		b = b.Elem()
+	}
+
+	switch {
+	case a.Kind() == reflect.String && b.Kind() == reflect.String:
+		return a.String() < b.String()
+	case isIntKind(a.Kind()) && isIntKind(b.Kind()):
+		return a.Int() < b.Int()
+	}
+
+	return false
+}
+
+func isIntKind(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Int64
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+
+	return false
+}
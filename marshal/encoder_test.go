@@ -0,0 +1,162 @@
+package marshal
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+type money struct {
+	Cents    int64
+	Currency string
+}
+
+func (m money) MarshalRuby() (interface{}, error) {
+	return Object{
+		Class: "Money",
+		Ivars: map[string]interface{}{
+			"@cents":    m.Cents,
+			"@currency": m.Currency,
+		},
+	}, nil
+}
+
+func (m *money) UnmarshalRuby(obj *MarshalledObject) error {
+	class, err := obj.GetClassName()
+	if err != nil {
+		return err
+	}
+	if class != "Money" {
+		return TypeMismatch
+	}
+
+	ivars, err := obj.GetAsObject()
+	if err != nil {
+		return err
+	}
+
+	if m.Cents, err = ivars["@cents"].GetAsInteger(); err != nil {
+		return err
+	}
+	m.Currency, err = ivars["@currency"].GetAsString()
+
+	return err
+}
+
+type taggedStruct struct {
+	ID      int64    `ruby:"id,symbol"`
+	Name    string   `ruby:"name"`
+	Tags    []string `ruby:"tags,omitempty"`
+	Skipped string   `ruby:"-"`
+}
+
+type marshalTestCase struct {
+	Value       interface{}
+	Expectation []byte
+}
+
+func TestMarshal(t *testing.T) {
+	tests := []marshalTestCase{
+		{nil, []byte{4, 8, 48}},
+		{true, []byte{4, 8, 84}},
+		{false, []byte{4, 8, 70}},
+		{0, []byte{4, 8, 105, 0}},
+		{1, []byte{4, 8, 105, 6}},
+		{-1, []byte{4, 8, 105, 250}},
+		{122, []byte{4, 8, 105, 127}},
+		{123, []byte{4, 8, 105, 1, 123}},
+		{-124, []byte{4, 8, 105, 255, 132}},
+		{256, []byte{4, 8, 105, 2, 0, 1}},
+		{-257, []byte{4, 8, 105, 254, 255, 254}},
+		{-(2 << 29), []byte{4, 8, 105, 252, 0, 0, 0, 192}},
+		{2 << 29, []byte{4, 8, 108, 43, 7, 0, 0, 0, 64}},
+		{-(1 << 40), []byte{4, 8, 108, 45, 8, 0, 0, 0, 0, 0, 1}},
+		{uint8(5), []byte{4, 8, 105, 10}},
+		{1.5, []byte{4, 8, 102, 8, 49, 46, 53}},
+		{"", []byte{4, 8, 73, 34, 0, 6, 58, 6, 69, 84}},
+		{"Hello, world", []byte{4, 8, 73, 34, 17, 72, 101, 108, 108, 111, 44, 32, 119, 111, 114, 108, 100, 6, 58, 6, 69, 84}},
+		{"\xff", []byte{4, 8, 34, 6, 255}},
+		{[]byte("foo"), []byte{4, 8, 34, 8, 102, 111, 111}},
+		{Symbol("hello"), []byte{4, 8, 58, 10, 104, 101, 108, 108, 111}},
+		{[]int{}, []byte{4, 8, 91, 0}},
+		{[]string(nil), []byte{4, 8, 48}},
+		{
+			[]interface{}{"foo", "bar", Symbol("baz")},
+			[]byte{4, 8, 91, 8, 73, 34, 8, 102, 111, 111, 6, 58, 6, 69, 84, 73, 34, 8, 98, 97, 114, 6, 59, 0, 84, 58, 8, 98, 97, 122},
+		},
+		{map[string]int{}, []byte{4, 8, 123, 0}},
+		{
+			map[Symbol]string{"foo": "bar"},
+			[]byte{4, 8, 123, 6, 58, 8, 102, 111, 111, 73, 34, 8, 98, 97, 114, 6, 58, 6, 69, 84},
+		},
+		{
+			taggedStruct{ID: 1, Name: "x", Skipped: "y"},
+			[]byte{4, 8, 123, 7, 58, 7, 105, 100, 105, 6, 73, 34, 9, 110, 97, 109, 101, 6, 58, 6, 69, 84, 73, 34, 6, 120, 6, 59, 6, 84},
+		},
+		{
+			money{100, "USD"},
+			[]byte{4, 8, 111, 58, 10, 77, 111, 110, 101, 121, 7, 58, 11, 64, 99, 101, 110, 116, 115, 105, 105, 58, 14, 64, 99, 117, 114, 114, 101, 110, 99, 121, 73, 34, 8, 85, 83, 68, 6, 58, 6, 69, 84},
+		},
+		{
+			Hash{{1, "a"}, {Symbol("b"), nil}},
+			[]byte{4, 8, 123, 7, 105, 6, 73, 34, 6, 97, 6, 58, 6, 69, 84, 58, 6, 98, 48},
+		},
+		{
+			Struct{"Point", []Pair{{"x", 1}, {"y", 2}}},
+			[]byte{4, 8, 83, 58, 10, 80, 111, 105, 110, 116, 7, 58, 6, 120, 105, 6, 58, 6, 121, 105, 7},
+		},
+		{
+			UserDefined{"BigDecimal", []byte("18:0.1e1")},
+			[]byte{4, 8, 117, 58, 15, 66, 105, 103, 68, 101, 99, 105, 109, 97, 108, 13, 49, 56, 58, 48, 46, 49, 101, 49},
+		},
+		{UserMarshal{"Set", []int{1}}, []byte{4, 8, 85, 58, 8, 83, 101, 116, 91, 6, 105, 6}},
+	}
+
+	for _, testCase := range tests {
+		data, err := Marshal(testCase.Value)
+
+		if err != nil {
+			t.Errorf("Marshal() returned an error: '%v' for %#v", err.Error(), testCase.Value)
+		}
+
+		if !bytes.Equal(data, testCase.Expectation) {
+			t.Errorf("Marshal() returned %v instead of %v for %#v", data, testCase.Expectation, testCase.Value)
+		}
+	}
+
+	if _, err := Marshal(make(chan int)); err != UnsupportedValue {
+		t.Errorf("Marshal() returned '%v' instead of '%v' for a channel", err, UnsupportedValue)
+	}
+
+	if _, err := Marshal(Struct{"Point", []Pair{{1, 2}}}); err != UnsupportedValue {
+		t.Errorf("Marshal() returned '%v' instead of '%v' for a struct member without a name", err, UnsupportedValue)
+	}
+}
+
+func TestEncoderEncode(t *testing.T) {
+	var buf bytes.Buffer
+
+	e := NewEncoder(&buf)
+	for _, v := range []interface{}{1, "x", []int{1}} {
+		if err := e.Encode(v); err != nil {
+			t.Fatalf("Encode() returned an error: %v", err)
+		}
+	}
+
+	d := NewDecoder(&buf)
+	for _, expectation := range []interface{}{int64(1), "x", []interface{}{int64(1)}} {
+		obj, err := d.Decode()
+		if err != nil {
+			t.Fatalf("Decode() returned an error for encoded data: %v", err)
+		}
+
+		var value interface{}
+		if err = obj.Unmarshal(&value); err != nil {
+			t.Errorf("Unmarshal() returned an error for encoded data: %v", err)
+		}
+
+		if !reflect.DeepEqual(value, expectation) {
+			t.Errorf("Decode() returned %#v instead of %#v", value, expectation)
+		}
+	}
+}
@@ -0,0 +1,362 @@
+package marshal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/format"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var NotAStructure = errors.New("gorails/marshal: sample is not a hash or an object")
+
+// GenerateStructs returns the gofmt'd source of package pkg declaring a
+// struct type name that all samples can be unmarshalled into, along with
+// struct types for nested hashes and objects, named after the fields holding
+// them. The samples must be hashes with string or symbol keys, or objects.
+//
+// Hash keys and instance variables become fields tagged with their Ruby
+// names, and with the "symbol" option if the key is a symbol in all samples.
+// Fields missing in some samples are tagged "omitempty". Such fields and
+// fields that are nil in some samples are pointers, unless they are slices or
+// interfaces.
+//
+// Fields holding integers in some samples and floats in others are float64,
+// fields holding values of other different types interface{}. Values
+// Unmarshal can not decode into Go types, e.g. Times, are *MarshalledObject.
+func GenerateStructs(pkg, name string, samples ...*MarshalledObject) ([]byte, error) {
+	var root *inferredType
+	for _, sample := range samples {
+		t := infer(sample, make(map[*byte]bool))
+		if t.kind != inferStruct {
+			return nil, NotAStructure
+		}
+
+		root = merge(root, t)
+	}
+	if root == nil {
+		return nil, NotAStructure
+	}
+
+	g := &generator{names: make(map[string]bool)}
+	g.declare(name, root)
+
+	var src bytes.Buffer
+	fmt.Fprintf(&src, "package %s\n\n", pkg)
+	if g.raw {
+		src.WriteString("import \"github.com/adjust/gorails/marshal\"\n\n")
+	}
+	for _, decl := range g.decls {
+		src.Write(decl)
+	}
+
+	return format.Source(src.Bytes())
+}
+
+type inferredKind byte
+
+const (
+	inferNil inferredKind = iota // only nil seen
+	inferBool
+	inferInt
+	inferFloat
+	inferString
+	inferSlice
+	inferStruct
+	inferAny
+	inferRaw
+)
+
+type inferredType struct {
+	kind     inferredKind
+	nullable bool
+
+	elem    *inferredType    // of a slice, nil if all slices were empty
+	fields  []*inferredField // of a struct, in order of appearance
+	samples int              // number of structs merged
+}
+
+type inferredField struct {
+	key    string
+	symbol bool
+	count  int // number of structs holding the field
+	typ    *inferredType
+}
+
+func infer(obj *MarshalledObject, seen map[*byte]bool) *inferredType {
+	if ref := obj.resolveObjectLink(); ref != nil {
+		obj = ref
+	}
+
+	switch obj.GetType() {
+	case TYPE_NIL:
+		return &inferredType{kind: inferNil, nullable: true}
+	case TYPE_BOOL:
+		return &inferredType{kind: inferBool}
+	case TYPE_INTEGER:
+		if _, err := obj.GetAsInteger(); err != nil {
+			return &inferredType{kind: inferRaw}
+		}
+		return &inferredType{kind: inferInt}
+	case TYPE_FLOAT:
+		return &inferredType{kind: inferFloat}
+	case TYPE_STRING:
+		return &inferredType{kind: inferString}
+	}
+
+	// Containers may be reached recursively through object links.
+	key := &obj.data[0]
+	if seen[key] {
+		return &inferredType{kind: inferRaw}
+	}
+	seen[key] = true
+	defer delete(seen, key)
+
+	if items, err := obj.GetAsSet(); err == nil {
+		return inferElements(items, seen)
+	}
+	if items, err := obj.GetAsOpenStruct(); err == nil {
+		names := make([]string, 0, len(items))
+		for name := range items {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		t := &inferredType{kind: inferStruct, samples: 1}
+		for _, name := range names {
+			t.addField(name, false, infer(items[name], seen))
+		}
+
+		return t
+	}
+
+	switch obj.GetType() {
+	case TYPE_ARRAY:
+		items, _ := obj.GetAsArray()
+		return inferElements(items, seen)
+	case TYPE_MAP:
+		t := &inferredType{kind: inferStruct, samples: 1}
+		for _, p := range obj.hashPairs() {
+			k := p.key
+			if ref := k.resolveObjectLink(); ref != nil {
+				k = ref
+			}
+			if k.GetType() != TYPE_STRING {
+				// e.g. integer keys, decoded into map[string]interface{}
+				return &inferredType{kind: inferAny}
+			}
+
+			name, _ := k.GetAsString()
+			symbol := k.data[0] == ':' || k.data[0] == ';' || k.data[0] == 'I' && k.data[1] == ':'
+			t.addField(name, symbol, infer(p.value, seen))
+		}
+
+		return t
+	case TYPE_OBJECT:
+		t := &inferredType{kind: inferStruct, samples: 1}
+		for _, p := range obj.objectPairs() {
+			t.addField(strings.TrimPrefix(p.name, "@"), false, infer(p.value, seen))
+		}
+
+		return t
+	}
+
+	return &inferredType{kind: inferRaw}
+}
+
+func inferElements(items []*MarshalledObject, seen map[*byte]bool) *inferredType {
+	t := &inferredType{kind: inferSlice}
+	for _, item := range items {
+		t.elem = merge(t.elem, infer(item, seen))
+	}
+
+	return t
+}
+
+// addField adds a field of a single struct. Keys occurring twice, e.g. as
+// a string and as a symbol, are merged.
+func (t *inferredType) addField(key string, symbol bool, typ *inferredType) {
+	for _, f := range t.fields {
+		if f.key == key {
+			f.symbol = f.symbol && symbol
+			f.typ = merge(f.typ, typ)
+			return
+		}
+	}
+
+	t.fields = append(t.fields, &inferredField{key: key, symbol: symbol, count: 1, typ: typ})
+}
+
+func merge(a, b *inferredType) *inferredType {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+
+	if a.kind == inferNil {
+		a, b = b, a
+	}
+
+	r := *a
+	r.nullable = a.nullable || b.nullable
+
+	switch {
+	case b.kind == inferNil:
+	case a.kind == b.kind && a.kind == inferSlice:
+		r.elem = merge(a.elem, b.elem)
+	case a.kind == b.kind && a.kind == inferStruct:
+		r.samples = a.samples + b.samples
+		r.fields = make([]*inferredField, len(a.fields))
+		for i, f := range a.fields {
+			copied := *f
+			r.fields[i] = &copied
+		}
+
+	fields:
+		for _, f := range b.fields {
+			for _, rf := range r.fields {
+				if rf.key == f.key {
+					rf.symbol = rf.symbol && f.symbol
+					rf.count += f.count
+					rf.typ = merge(rf.typ, f.typ)
+					continue fields
+				}
+			}
+
+			copied := *f
+			r.fields = append(r.fields, &copied)
+		}
+	case a.kind == b.kind:
+	case (a.kind == inferInt || a.kind == inferFloat) && (b.kind == inferInt || b.kind == inferFloat):
+		r.kind = inferFloat
+	case a.kind == inferRaw || b.kind == inferRaw:
+		r = inferredType{kind: inferRaw}
+	default:
+		r = inferredType{kind: inferAny}
+	}
+
+	return &r
+}
+
+type generator struct {
+	decls [][]byte // in order of first use, the outer type first
+	names map[string]bool
+	raw   bool // whether *marshal.MarshalledObject is used
+}
+
+// declare adds the declaration of struct type t with a name derived from
+// name, followed by those of its nested types, and returns the name.
+func (g *generator) declare(name string, t *inferredType) string {
+	typeName := name
+	for i := 2; g.names[typeName]; i++ {
+		typeName = name + strconv.Itoa(i)
+	}
+	g.names[typeName] = true
+
+	slot := len(g.decls)
+	g.decls = append(g.decls, nil)
+
+	var decl bytes.Buffer
+	fmt.Fprintf(&decl, "type %s struct {\n", typeName)
+
+	fieldNames := make(map[string]bool)
+	for _, f := range t.fields {
+		fieldName := goName(f.key)
+		base := fieldName
+		for i := 2; fieldNames[fieldName]; i++ {
+			fieldName = base + strconv.Itoa(i)
+		}
+		fieldNames[fieldName] = true
+
+		optional := f.count < t.samples
+
+		tag := f.key
+		if f.symbol {
+			tag += ",symbol"
+		}
+		if optional {
+			tag += ",omitempty"
+		}
+		tag = "ruby:" + strconv.Quote(tag)
+		if strings.Contains(tag, "`") {
+			tag = strconv.Quote(tag)
+		} else {
+			tag = "`" + tag + "`"
+		}
+
+		fmt.Fprintf(&decl, "%s %s %s\n", fieldName, g.goType(typeName+fieldName, f.typ, optional), tag)
+	}
+	decl.WriteString("}\n\n")
+
+	g.decls[slot] = decl.Bytes()
+
+	return typeName
+}
+
+func (g *generator) goType(name string, t *inferredType, optional bool) string {
+	var typ string
+	switch t.kind {
+	case inferBool:
+		typ = "bool"
+	case inferInt:
+		typ = "int64"
+	case inferFloat:
+		typ = "float64"
+	case inferString:
+		typ = "string"
+	case inferSlice:
+		if t.elem == nil {
+			return "[]interface{}"
+		}
+		return "[]" + g.goType(name+"Item", t.elem, false)
+	case inferStruct:
+		typ = g.declare(name, t)
+	case inferRaw:
+		g.raw = true
+		return "*marshal.MarshalledObject"
+	default:
+		return "interface{}"
+	}
+
+	if optional || t.nullable {
+		return "*" + typ
+	}
+
+	return typ
+}
+
+var initialisms = map[string]bool{
+	"API": true, "CSRF": true, "HTML": true, "HTTP": true, "ID": true, "IP": true,
+	"JSON": true, "SQL": true, "URI": true, "URL": true, "UUID": true,
+}
+
+// goName returns an exported Go identifier for a Ruby hash key or instance
+// variable name, e.g. "UserID" for "user_id".
+func goName(key string) string {
+	words := strings.FieldsFunc(key, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	var name string
+	for _, w := range words {
+		if initialisms[strings.ToUpper(w)] {
+			name += strings.ToUpper(w)
+			continue
+		}
+
+		runes := []rune(w)
+		runes[0] = unicode.ToUpper(runes[0])
+		name += string(runes)
+	}
+
+	if name == "" || !unicode.IsLetter([]rune(name)[0]) {
+		name = "X" + name
+	}
+
+	return name
+}
@@ -0,0 +1,136 @@
+package marshal
+
+import (
+	"strings"
+	"testing"
+)
+
+type generateTestCase struct {
+	Samples     []interface{}
+	Expectation string
+}
+
+func TestGenerateStructs(t *testing.T) {
+	tests := []generateTestCase{
+		{
+			[]interface{}{Hash{{Symbol("user_id"), 1}, {"name", "bob"}, {"score", 1.5}, {"admin", false}}},
+			"type Payload struct {\n" +
+				"\tUserID int64   `ruby:\"user_id,symbol\"`\n" +
+				"\tName   string  `ruby:\"name\"`\n" +
+				"\tScore  float64 `ruby:\"score\"`\n" +
+				"\tAdmin  bool    `ruby:\"admin\"`\n" +
+				"}\n",
+		},
+		{
+			// optional, nullable and merged fields
+			[]interface{}{
+				Hash{{"id", 1}, {"score", 1}, {"tag", nil}, {"value", 1}, {"key", "a"}},
+				Hash{{"id", 2}, {"score", 2.5}, {"tag", "x"}, {"value", "one"}, {Symbol("key"), "b"}, {"locale", "en"}},
+			},
+			"type Payload struct {\n" +
+				"\tID     int64       `ruby:\"id\"`\n" +
+				"\tScore  float64     `ruby:\"score\"`\n" +
+				"\tTag    *string     `ruby:\"tag\"`\n" +
+				"\tValue  interface{} `ruby:\"value\"`\n" +
+				"\tKey    string      `ruby:\"key\"`\n" +
+				"\tLocale *string     `ruby:\"locale,omitempty\"`\n" +
+				"}\n",
+		},
+		{
+			// nested hashes, arrays of hashes and objects
+			[]interface{}{
+				Hash{
+					{"flash", Hash{{"discard", []string{}}, {"flashes", Hash{{"notice", "hi"}}}}},
+					{"items", []interface{}{Hash{{"sku", "a"}}, Hash{{"sku", "b"}, {"qty", 2}}}},
+					{"user", Object{Class: "User", Ivars: map[string]interface{}{"@id": 1}}},
+					{"empty", []interface{}{}},
+				},
+			},
+			"type Payload struct {\n" +
+				"\tFlash PayloadFlash       `ruby:\"flash\"`\n" +
+				"\tItems []PayloadItemsItem `ruby:\"items\"`\n" +
+				"\tUser  PayloadUser        `ruby:\"user\"`\n" +
+				"\tEmpty []interface{}      `ruby:\"empty\"`\n" +
+				"}\n\n" +
+				"type PayloadFlash struct {\n" +
+				"\tDiscard []interface{}       `ruby:\"discard\"`\n" +
+				"\tFlashes PayloadFlashFlashes `ruby:\"flashes\"`\n" +
+				"}\n\n" +
+				"type PayloadFlashFlashes struct {\n" +
+				"\tNotice string `ruby:\"notice\"`\n" +
+				"}\n\n" +
+				"type PayloadItemsItem struct {\n" +
+				"\tSku string `ruby:\"sku\"`\n" +
+				"\tQty *int64 `ruby:\"qty,omitempty\"`\n" +
+				"}\n\n" +
+				"type PayloadUser struct {\n" +
+				"\tID int64 `ruby:\"id\"`\n" +
+				"}\n",
+		},
+		{
+			// values Unmarshal can not decode, odd keys
+			[]interface{}{
+				Hash{{"at", UserDefined{Class: "Time", Data: []byte{0}}}, {"2fa", true}, {"a-b", 1}, {"a_b", 2}, {"map", map[int]int{1: 2}}},
+			},
+			"import \"github.com/adjust/gorails/marshal\"\n\n" +
+				"type Payload struct {\n" +
+				"\tAt   *marshal.MarshalledObject `ruby:\"at\"`\n" +
+				"\tX2fa bool                      `ruby:\"2fa\"`\n" +
+				"\tAB   int64                     `ruby:\"a-b\"`\n" +
+				"\tAB2  int64                     `ruby:\"a_b\"`\n" +
+				"\tMap  interface{}               `ruby:\"map\"`\n" +
+				"}\n",
+		},
+	}
+
+	for _, testCase := range tests {
+		var samples []*MarshalledObject
+		for _, sample := range testCase.Samples {
+			data, err := Marshal(sample)
+			if err != nil {
+				t.Fatalf("Marshal(%#v) returned error %v", sample, err)
+			}
+			samples = append(samples, CreateMarshalledObject(data))
+		}
+
+		src, err := GenerateStructs("app", "Payload", samples...)
+		if err != nil {
+			t.Errorf("GenerateStructs(%v) returned error %v", testCase.Samples, err)
+			continue
+		}
+
+		expected := "package app\n\n" + testCase.Expectation
+		if string(src) != expected {
+			t.Errorf("GenerateStructs(%v) returned\n%s\ninstead of\n%s", testCase.Samples, src, expected)
+		}
+	}
+}
+
+func TestGenerateStructsNotAStructure(t *testing.T) {
+	if _, err := GenerateStructs("app", "Payload"); err != NotAStructure {
+		t.Errorf("GenerateStructs() returned error %v instead of %v", err, NotAStructure)
+	}
+
+	if _, err := GenerateStructs("app", "Payload", CreateMarshalledObject([]byte{4, 8, 91, 0})); err != NotAStructure {
+		t.Errorf("GenerateStructs([]) returned error %v instead of %v", err, NotAStructure)
+	}
+}
+
+func TestGenerateStructsBinaryStringKey(t *testing.T) {
+	// {"kkk…" => 1} with a binary key of 53 bytes, whose length byte is ':'
+	key := strings.Repeat("k", 53)
+	data := append([]byte{4, 8, '{', 6, '"', 0x3a}, key...)
+	data = append(data, 'i', 6)
+
+	src, err := GenerateStructs("app", "Payload", CreateMarshalledObject(data))
+	if err != nil {
+		t.Fatalf("GenerateStructs(%q) returned error %v", data, err)
+	}
+
+	if strings.Contains(string(src), ",symbol") {
+		t.Errorf("GenerateStructs(%q) tagged a string key as a symbol:\n%s", data, src)
+	}
+	if !strings.Contains(string(src), "`ruby:\""+key+"\"`") {
+		t.Errorf("GenerateStructs(%q) returned\n%s\nwithout a field for the key", data, src)
+	}
+}
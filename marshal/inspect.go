@@ -0,0 +1,335 @@
+package marshal
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Inspect returns a representation of obj in the format of Ruby's Kernel#p,
+// e.g. {:foo=>"bar", "n"=>1}. Recursive references are shown as [...] and
+// {...} as Ruby does.
+func (obj *MarshalledObject) Inspect() string {
+	var buf bytes.Buffer
+	obj.inspect(&buf, make(map[*byte]bool))
+
+	return buf.String()
+}
+
+func (obj *MarshalledObject) inspect(buf *bytes.Buffer, seen map[*byte]bool) {
+	if ref := obj.resolveObjectLink(); ref != nil {
+		ref.inspect(buf, seen)
+		return
+	}
+
+	if len(obj.data) == 0 {
+		buf.WriteString("#<unknown>")
+		return
+	}
+
+	// Corrupted or truncated dumps end in the middle of a value.
+	if !obj.complete() {
+		buf.WriteString("#<incomplete>")
+		return
+	}
+
+	// Only containers can be reached recursively through object links.
+	switch obj.data[0] {
+	case '[', '{', '}', 'o', 'S', 'U', 'd', 'e', 'C':
+		key := &obj.data[0]
+		if seen[key] {
+			buf.WriteString(recursionPlaceholder(obj.data[0]))
+			return
+		}
+
+		seen[key] = true
+		defer delete(seen, key)
+	}
+
+	switch obj.data[0] {
+	case '0':
+		buf.WriteString("nil")
+	case 'T':
+		buf.WriteString("true")
+	case 'F':
+		buf.WriteString("false")
+	case 'i':
+		value, _ := obj.GetAsInteger()
+		buf.WriteString(strconv.FormatInt(value, 10))
+	case 'l':
+		buf.WriteString(parseBigInt(obj.data[1:]).String())
+	case 'f':
+		value, _ := obj.GetAsFloat()
+		buf.WriteString(inspectFloat(value))
+	case ':', ';':
+		value, _ := obj.GetAsString()
+		buf.WriteString(inspectSymbol(value))
+	case '"':
+		value, _ := obj.GetAsString()
+		buf.WriteString(inspectString(value, false))
+	case 'I':
+		inner := obj.child(1)
+
+		switch inner.data[0] {
+		case '"':
+			value, _ := inner.GetAsString()
+			buf.WriteString(inspectString(value, obj.hasEncoding()))
+		case ':':
+			value, _ := inner.GetAsString()
+			buf.WriteString(inspectSymbol(value))
+		default:
+			inner.inspect(buf, seen)
+		}
+	case '[':
+		value, _ := obj.GetAsArray()
+
+		buf.WriteByte('[')
+		for i, v := range value {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			v.inspect(buf, seen)
+		}
+		buf.WriteByte(']')
+	case '{', '}':
+		count, offset := parseInt(obj.data[1:])
+		keys, values, _ := obj.pairs(offset+1, count)
+
+		buf.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			k.inspect(buf, seen)
+			buf.WriteString("=>")
+			values[i].inspect(buf, seen)
+		}
+		buf.WriteByte('}')
+	case 'o', 'S':
+		class := obj.child(1)
+		name, _ := class.GetAsString()
+		offset := 1 + class.getSize()
+		count, size := parseInt(obj.data[offset:])
+		keys, values, _ := obj.pairs(offset+size, count)
+
+		buf.WriteString("#<")
+		if obj.data[0] == 'S' {
+			buf.WriteString("struct ")
+		}
+		buf.WriteString(name)
+		for i, k := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteByte(' ')
+			buf.WriteString(k.ToString())
+			buf.WriteByte('=')
+			values[i].inspect(buf, seen)
+		}
+		buf.WriteByte('>')
+	case 'u':
+		class := obj.child(1)
+		name, _ := class.GetAsString()
+		value, _ := parseString(obj.data[1+class.getSize():])
+
+		fmt.Fprintf(buf, "#<%s _dump=%s>", name, inspectString(value, false))
+	case 'U', 'd':
+		class := obj.child(1)
+		name, _ := class.GetAsString()
+
+		method := "marshal_dump"
+		if obj.data[0] == 'd' {
+			method = "_dump_data"
+		}
+
+		fmt.Fprintf(buf, "#<%s %s=", name, method)
+		obj.child(1+class.getSize()).inspect(buf, seen)
+		buf.WriteByte('>')
+	case 'e', 'C':
+		obj.child(1+obj.child(1).getSize()).inspect(buf, seen)
+	case '/':
+		source, size := parseString(obj.data[1:])
+		options := obj.data[1+size]
+
+		buf.WriteByte('/')
+		buf.WriteString(strings.Replace(source, "/", "\\/", -1))
+		buf.WriteByte('/')
+		for _, flag := range regexpFlags {
+			if options&flag.bit != 0 {
+				buf.WriteByte(flag.name)
+			}
+		}
+	case 'c', 'm', 'M':
+		name, _ := parseString(obj.data[1:])
+		buf.WriteString(name)
+	default:
+		fmt.Fprintf(buf, "#<unknown type %q>", obj.data[0])
+	}
+}
+
+var regexpFlags = []struct {
+	bit  byte
+	name byte
+}{{4, 'm'}, {1, 'i'}, {2, 'x'}}
+
+func recursionPlaceholder(c byte) string {
+	switch c {
+	case '[':
+		return "[...]"
+	case '{', '}':
+		return "{...}"
+	}
+
+	return "#<...>"
+}
+
+// hasEncoding reports whether a string wrapped with instance variables is
+// tagged with a Unicode-compatible encoding (E=true or a UTF encoding name).
+func (obj *MarshalledObject) hasEncoding() bool {
+	offset := 1 + obj.child(1).getSize()
+	count, size := parseInt(obj.data[offset:])
+	keys, values, _ := obj.pairs(offset+size, count)
+
+	for i, k := range keys {
+		switch k.ToString() {
+		case "E":
+			return values[i].data[0] == 'T'
+		case "encoding":
+			name, _ := values[i].GetAsString()
+			return strings.HasPrefix(strings.ToUpper(name), "UTF-")
+		}
+	}
+
+	return false
+}
+
+func parseBigInt(data []byte) *big.Int {
+	length, offset := parseInt(data[1:])
+	offset += 1
+
+	magnitude := make([]byte, 0, capacity(length*2, len(data)-offset))
+	for i := offset + int(length)*2 - 1; i >= offset && i < len(data); i-- {
+		magnitude = append(magnitude, data[i])
+	}
+
+	value := new(big.Int).SetBytes(magnitude)
+	if data[0] == '-' {
+		value.Neg(value)
+	}
+
+	return value
+}
+
+// inspectFloat mimics Float#inspect: the shortest representation that reads
+// back as the same value, in scientific notation outside of 1e-4...1e16.
+func inspectFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	case math.IsNaN(f):
+		return "NaN"
+	case f == 0 && math.Signbit(f):
+		return "-0.0"
+	case f == 0:
+		return "0.0"
+	}
+
+	s := strconv.FormatFloat(f, 'e', -1, 64)
+	mantissa, exp := s[:strings.IndexByte(s, 'e')], s[strings.IndexByte(s, 'e')+1:]
+	e, _ := strconv.Atoi(exp)
+
+	if e < -4 || e >= 16 {
+		if !strings.Contains(mantissa, ".") {
+			mantissa += ".0"
+		}
+		return fmt.Sprintf("%se%+03d", mantissa, e)
+	}
+
+	s = strconv.FormatFloat(f, 'f', -1, 64)
+	if !strings.Contains(s, ".") {
+		s += ".0"
+	}
+
+	return s
+}
+
+var plainSymbol = regexp.MustCompile(`^(?:(?:\$|@@?)?[A-Za-z_][A-Za-z0-9_]*|[A-Za-z_][A-Za-z0-9_]*[?!=])$`)
+
+var operatorSymbols = map[string]bool{
+	"+": true, "-": true, "*": true, "/": true, "%": true, "**": true,
+	"==": true, "===": true, "!=": true, "<": true, ">": true, "<=": true,
+	">=": true, "<=>": true, "<<": true, ">>": true, "!": true, "~": true,
+	"[]": true, "[]=": true, "=~": true, "!~": true, "&": true, "|": true,
+	"^": true, "+@": true, "-@": true,
+}
+
+func inspectSymbol(s string) string {
+	if plainSymbol.MatchString(s) || operatorSymbols[s] {
+		return ":" + s
+	}
+
+	return ":" + inspectString(s, true)
+}
+
+// inspectString quotes s the way String#inspect does. Binary strings have
+// all non-ASCII bytes escaped, Unicode strings only unprintable characters.
+func inspectString(s string, unicodeString bool) string {
+	var buf bytes.Buffer
+
+	buf.WriteByte('"')
+	for i := 0; i < len(s); {
+		r, size := rune(s[i]), 1
+		if unicodeString && s[i] >= utf8.RuneSelf {
+			r, size = utf8.DecodeRuneInString(s[i:])
+		}
+
+		switch {
+		case r == '"' || r == '\\':
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		case r == '#' && i+1 < len(s) && (s[i+1] == '{' || s[i+1] == '$' || s[i+1] == '@'):
+			buf.WriteString("\\#")
+		case r == '\n':
+			buf.WriteString("\\n")
+		case r == '\t':
+			buf.WriteString("\\t")
+		case r == '\r':
+			buf.WriteString("\\r")
+		case r == '\f':
+			buf.WriteString("\\f")
+		case r == '\v':
+			buf.WriteString("\\v")
+		case r == '\b':
+			buf.WriteString("\\b")
+		case r == '\a':
+			buf.WriteString("\\a")
+		case r == 0x1b:
+			buf.WriteString("\\e")
+		case r == utf8.RuneError && size == 1, !unicodeString && r >= utf8.RuneSelf:
+			fmt.Fprintf(&buf, "\\x%02X", s[i])
+		case r < utf8.RuneSelf && (r < 0x20 || r == 0x7f):
+			if unicodeString && r != 0x7f {
+				fmt.Fprintf(&buf, "\\u%04X", r)
+			} else {
+				fmt.Fprintf(&buf, "\\x%02X", r)
+			}
+		case !unicode.IsPrint(r):
+			fmt.Fprintf(&buf, "\\u%04X", r)
+		default:
+			buf.WriteString(s[i : i+size])
+		}
+
+		i += size
+	}
+	buf.WriteByte('"')
+
+	return buf.String()
+}
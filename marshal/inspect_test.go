@@ -0,0 +1,54 @@
+package marshal
+
+import (
+	"testing"
+)
+
+type inspectTestCase struct {
+	Data        []byte
+	Expectation string
+}
+
+func TestInspect(t *testing.T) {
+	tests := []inspectTestCase{
+		{[]byte{4, 8, 48}, "nil"},
+		{[]byte{4, 8, 84}, "true"},
+		{[]byte{4, 8, 70}, "false"},
+		{[]byte{4, 8, 105, 250}, "-1"},
+		{[]byte{4, 8, 108, 43, 10, 0, 0, 0, 0, 0, 0, 0, 0, 64, 0}, "1180591620717411303424"},
+		{[]byte{4, 8, 102, 8, 49, 46, 53}, "1.5"},
+		{[]byte{4, 8, 102, 6, 49}, "1.0"},
+		{[]byte{4, 8, 102, 9, 49, 101, 50, 48}, "1.0e+20"},
+		{[]byte{4, 8, 102, 11, 49, 46, 53, 101, 45, 53}, "1.5e-05"},
+		{[]byte{4, 8, 102, 8, 105, 110, 102}, "Infinity"},
+		{[]byte{4, 8, 73, 34, 11, 97, 34, 98, 10, 35, 123, 6, 58, 6, 69, 84}, `"a\"b\n\#{"`},
+		{[]byte{4, 8, 73, 34, 7, 195, 169, 6, 58, 6, 69, 84}, `"é"`},
+		{[]byte{4, 8, 34, 6, 255}, `"\xFF"`},
+		{[]byte{4, 8, 58, 12, 102, 111, 111, 32, 98, 97, 114}, `:"foo bar"`},
+		{[]byte{4, 8, 58, 9, 102, 111, 111, 63}, ":foo?"},
+		{[]byte{4, 8, 91, 6, 64, 0}, "[[...]]"},
+		{
+			[]byte{4, 8, 123, 7, 58, 8, 102, 111, 111, 73, 34, 8, 98, 97, 114, 6, 58, 6, 69, 84, 73, 34, 6, 110, 6, 59, 6, 84, 105, 6},
+			`{:foo=>"bar", "n"=>1}`,
+		},
+		{moneyData, `#<Money @cents=100, @currency="USD">`},
+		{[]byte{4, 8, 83, 58, 10, 80, 111, 105, 110, 116, 7, 58, 6, 120, 105, 6, 58, 6, 121, 105, 7}, "#<struct Point x=1, y=2>"},
+		{[]byte{4, 8, 73, 47, 7, 97, 98, 1, 6, 58, 6, 69, 70}, "/ab/i"},
+		{[]byte{4, 8, 99, 11, 83, 116, 114, 105, 110, 103}, "String"},
+		// truncated or corrupted dumps
+		{[]byte{4, 8, 99}, "#<incomplete>"},
+		{[]byte{4, 8, 105}, "#<incomplete>"},
+		{[]byte{4, 8, 34}, "#<incomplete>"},
+		{[]byte{4, 8, 47, 6, 97}, "#<incomplete>"},
+		{[]byte{4, 8, 73, 34, 6, 97}, "#<incomplete>"},
+		{[]byte{4, 8, 111, 58, 6, 65}, "#<incomplete>"},
+		{[]byte{4, 8, 64, 254}, "#<incomplete>"},
+		{[]byte{4, 8, 59, 249}, `:""`},
+	}
+
+	for _, testCase := range tests {
+		if value := CreateMarshalledObject(testCase.Data).Inspect(); value != testCase.Expectation {
+			t.Errorf("Inspect() returned '%v' instead of '%v'", value, testCase.Expectation)
+		}
+	}
+}
@@ -9,16 +9,19 @@ type MarshalledObject struct {
 	MajorVersion byte
 	MinorVersion byte
 
-	data         []byte
-  symbolCache  *[]string
-  objectCache  *[]*MarshalledObject
-  size         int
+	data        []byte
+	symbolCache *[]string
+	objectCache *[]*MarshalledObject
+	size        int
 }
 
 type marshalledObjectType byte
 
 var TypeMismatch = errors.New("gorails/marshal: an attempt to implicitly typecast a marshalled object")
 var IncompleteData = errors.New("gorails/marshal: incomplete data")
+var MalformedData = errors.New("gorails/marshal: malformed data")
+var UnsupportedVersion = errors.New("gorails/marshal: unsupported marshal format version")
+var IntegerOverflow = errors.New("gorails/marshal: integer value does not fit into int64")
 
 const (
 	TYPE_UNKNOWN marshalledObjectType = 0
@@ -29,20 +32,18 @@ const (
 	TYPE_STRING  marshalledObjectType = 5
 	TYPE_ARRAY   marshalledObjectType = 6
 	TYPE_MAP     marshalledObjectType = 7
+	TYPE_OBJECT  marshalledObjectType = 8
 )
 
 func newMarshalledObject(major_version, minor_version byte, data []byte, symbolCache *[]string, objectCache *[]*MarshalledObject) *MarshalledObject {
-	return newMarshalledObjectWithSize(major_version, minor_version, data, len(data), symbolCache, objectCache)
-}
-
-func newMarshalledObjectWithSize(major_version, minor_version byte, data []byte, size int, symbolCache *[]string, objectCache *[]*MarshalledObject) *MarshalledObject {
-	return &(MarshalledObject{major_version, minor_version, data, symbolCache, objectCache, size})
+	return &(MarshalledObject{major_version, minor_version, data, symbolCache, objectCache, 0})
 }
 
 func CreateMarshalledObject(serialized_data []byte) *MarshalledObject {
-	symbolCache := []string{}
-	objectCache := []*MarshalledObject{}
-	return newMarshalledObject(serialized_data[0], serialized_data[1], serialized_data[2:], &symbolCache, &objectCache)
+	s := &scanner{data: serialized_data, record: true}
+	s.dump()
+
+	return s.marshalledObject()
 }
 
 func (obj *MarshalledObject) GetType() marshalledObjectType {
@@ -59,20 +60,22 @@ func (obj *MarshalledObject) GetType() marshalledObjectType {
 		return TYPE_NIL
 	case 'T', 'F':
 		return TYPE_BOOL
-	case 'i':
+	case 'i', 'l':
 		return TYPE_INTEGER
 	case 'f':
 		return TYPE_FLOAT
-	case ':', ';':
+	case ':', ';', '"':
 		return TYPE_STRING
 	case 'I':
-		if len(obj.data) > 1 && obj.data[1] == '"' {
+		if len(obj.data) > 1 && (obj.data[1] == '"' || obj.data[1] == ':') {
 			return TYPE_STRING
 		}
 	case '[':
 		return TYPE_ARRAY
-	case '{':
+	case '{', '}':
 		return TYPE_MAP
+	case 'o', 'S':
+		return TYPE_OBJECT
 	}
 
 	return TYPE_UNKNOWN
@@ -90,17 +93,29 @@ func (obj *MarshalledObject) GetAsBool() (value bool, err error) {
 }
 
 func (obj *MarshalledObject) GetAsInteger() (value int64, err error) {
+	if ref := obj.resolveObjectLink(); ref != nil {
+		return ref.GetAsInteger()
+	}
+
 	err = assertType(obj, TYPE_INTEGER)
 	if err != nil {
 		return
 	}
 
+	if obj.data[0] == 'l' {
+		return parseBignum(obj.data[1:])
+	}
+
 	value, _ = parseInt(obj.data[1:])
 
 	return
 }
 
 func (obj *MarshalledObject) GetAsFloat() (value float64, err error) {
+	if ref := obj.resolveObjectLink(); ref != nil {
+		return ref.GetAsFloat()
+	}
+
 	err = assertType(obj, TYPE_FLOAT)
 	if err != nil {
 		return
@@ -122,19 +137,18 @@ func (obj *MarshalledObject) GetAsString() (value string, err error) {
 		return
 	}
 
-	obj.cacheObject(obj)
-
-	var cache []string
-  if obj.data[0] == ':' {
+	switch obj.data[0] {
+	case ':', '"':
 		value, _ = parseString(obj.data[1:])
-		obj.cacheSymbols(value)
-  } else if obj.data[0] == ';' {
-  	ref_index, _ := parseInt(obj.data[1:])
-    cache := *(obj.symbolCache)
-    value = cache[ref_index]
-	} else {
-		value, _, cache = parseStringWithEncoding(obj.data[2:])
-		obj.cacheSymbols(cache...)
+	case ';':
+		ref_index, _ := parseInt(obj.data[1:])
+		cache := *(obj.symbolCache)
+
+		if ref_index >= 0 && int(ref_index) < len(cache) {
+			value = cache[ref_index]
+		}
+	case 'I':
+		return obj.child(1).GetAsString()
 	}
 
 	return
@@ -150,34 +164,16 @@ func (obj *MarshalledObject) GetAsArray() (value []*MarshalledObject, err error)
 		return
 	}
 
-	obj.cacheObject(obj)
-
 	array_size, offset := parseInt(obj.data[1:])
-  offset += 1
-
-	value = make([]*MarshalledObject, array_size)
-	for i := int64(0); i < array_size; i++ {
-		value_size := newMarshalledObjectWithSize(
-			obj.MajorVersion,
-			obj.MinorVersion,
-			obj.data[offset:],
-			0,
-      obj.symbolCache,
-      obj.objectCache,
-		).getSize()
-
-		value[i] = newMarshalledObject(
-			obj.MajorVersion,
-			obj.MinorVersion,
-			obj.data[offset:offset+value_size],
-      obj.symbolCache,
-      obj.objectCache,
-		)
-		obj.cacheObject(value[i])
-		offset += value_size
-	}
-
-	obj.size = offset
+	offset += 1
+
+	value = make([]*MarshalledObject, 0, capacity(array_size, len(obj.data)-offset))
+	for i := int64(0); i < array_size && offset < len(obj.data); i++ {
+		v := obj.child(offset)
+		offset += v.getSize()
+
+		value = append(value, v)
+	}
 
 	return
 }
@@ -192,150 +188,132 @@ func (obj *MarshalledObject) GetAsMap() (value map[string]*MarshalledObject, err
 		return
 	}
 
-	obj.cacheObject(obj)
-
 	map_size, offset := parseInt(obj.data[1:])
 	offset += 1
 
-	value = make(map[string]*MarshalledObject, map_size)
-	for i := int64(0); i < map_size; i++ {
-		k := newMarshalledObject(
-			obj.MajorVersion,
-			obj.MinorVersion,
-			obj.data[offset:],
-      obj.symbolCache,
-      obj.objectCache,
-		)
-		obj.cacheObject(k)
-		offset += k.getSize()
-
-		value_size := newMarshalledObjectWithSize(
-			obj.MajorVersion,
-			obj.MinorVersion,
-			obj.data[offset:],
-			0,
-      obj.symbolCache,
-      obj.objectCache,
-		).getSize()
+	keys, values, _ := obj.pairs(offset, map_size)
 
-		v := newMarshalledObject(
-			obj.MajorVersion,
-			obj.MinorVersion,
-			obj.data[offset:offset+value_size],
-      obj.symbolCache,
-      obj.objectCache,
-		)
-		obj.cacheObject(v)
-		value[k.ToString()] = v
-
-		offset += value_size
+	value = make(map[string]*MarshalledObject, len(keys))
+	for i, k := range keys {
+		value[k.ToString()] = values[i]
 	}
 
-	obj.size = offset
-
 	return
 }
 
-func assertType(obj *MarshalledObject, expected_type marshalledObjectType) (err error) {
-	if obj.GetType() != expected_type {
-		err = TypeMismatch
+// GetClassName returns the name of the Ruby class of an object.
+func (obj *MarshalledObject) GetClassName() (value string, err error) {
+	if ref := obj.resolveObjectLink(); ref != nil {
+		return ref.GetClassName()
 	}
 
-	return
-}
+	err = assertType(obj, TYPE_OBJECT)
+	if err != nil {
+		return
+	}
 
-func (obj *MarshalledObject) getSize() int {
-	header_size, data_size := 0, 0
+	return obj.child(1).GetAsString()
+}
 
-	if len(obj.data) > 0 && obj.data[0] == '@' {
-		header_size = 1
-		_, data_size = parseInt(obj.data[1:])
-		return header_size + data_size
+// GetAsObject returns the instance variables of an object keyed by their
+// names, e.g. "@cents". Members of a Ruby Struct are keyed without "@".
+func (obj *MarshalledObject) GetAsObject() (value map[string]*MarshalledObject, err error) {
+	if ref := obj.resolveObjectLink(); ref != nil {
+		return ref.GetAsObject()
 	}
 
-	switch obj.GetType() {
-	case TYPE_NIL, TYPE_BOOL:
-		header_size = 0
-		data_size   = 1
-	case TYPE_INTEGER:
-		header_size = 1
-		_, data_size = parseInt(obj.data[header_size:])
-	case TYPE_STRING, TYPE_FLOAT:
-		header_size = 1
+	err = assertType(obj, TYPE_OBJECT)
+	if err != nil {
+		return
+	}
 
-		if obj.data[0] == ';' {
-			_, data_size = parseInt(obj.data[header_size:])
-		} else {
-			var cache []string
-
-			if obj.data[0] == 'I' {
-				header_size += 1
-				_, data_size, cache = parseStringWithEncoding(obj.data[header_size:])
-				obj.cacheSymbols(cache...)
-			} else {
-				var symbol string
-				symbol, data_size = parseString(obj.data[header_size:])
-				obj.cacheSymbols(symbol)
-			}
-		}
-	case TYPE_ARRAY:
-		if obj.size == 0 {
-			obj.GetAsArray()
-		}
+	offset := 1 + obj.child(1).getSize()
+	ivars_count, size := parseInt(obj.data[offset:])
+	offset += size
 
-		return obj.size
-	case TYPE_MAP:
-		if obj.size == 0 {
-			obj.GetAsMap()
-		}
+	keys, values, _ := obj.pairs(offset, ivars_count)
 
-		return obj.size
+	value = make(map[string]*MarshalledObject, len(keys))
+	for i, k := range keys {
+		value[k.ToString()] = values[i]
 	}
 
-	return header_size + data_size
+	return
 }
 
-func (obj *MarshalledObject) cacheSymbols(symbols ...string) {
-	if len(symbols) == 0 {
-		return
-	}
+// pairs returns count consecutive key-value pairs starting at offset, in
+// the order they were dumped, and the offset following the last pair.
+func (obj *MarshalledObject) pairs(offset int, count int64) (keys, values []*MarshalledObject, end int) {
+	keys = make([]*MarshalledObject, 0, capacity(count, len(obj.data)-offset))
+	values = make([]*MarshalledObject, 0, capacity(count, len(obj.data)-offset))
+
+	for i := int64(0); i < count && offset < len(obj.data); i++ {
+		k := obj.child(offset)
+		offset += k.getSize()
 
-	cache := *(obj.symbolCache)
+		v := obj.child(offset)
+		offset += v.getSize()
 
-	known := make(map[string]struct{})
-	for _, symbol := range cache {
-		known[symbol] = struct{}{}
+		keys = append(keys, k)
+		values = append(values, v)
 	}
 
-	for _, symbol := range symbols {
-		_, exists := known[symbol]
+	return keys, values, offset
+}
 
-		if ! exists {
-			cache = append(cache, symbol)
-		}
+// capacity limits a preallocation for count items to what the remaining
+// data could possibly hold, as every value takes at least one byte.
+func capacity(count int64, remaining int) int {
+	if count < 0 || remaining < 0 {
+		return 0
+	}
+	if count > int64(remaining) {
+		return remaining
 	}
 
-	*(obj.symbolCache) = cache
+	return int(count)
 }
 
-func (obj *MarshalledObject) cacheObject(object *MarshalledObject) {
-	if len(object.data) > 0 && (object.data[0] == '@' || object.data[0] == ':' || object.data[0] == ';') {
-		return
+func assertType(obj *MarshalledObject, expected_type marshalledObjectType) (err error) {
+	if obj.GetType() != expected_type {
+		err = TypeMismatch
 	}
-	if t := obj.GetType(); !(t == TYPE_STRING || t == TYPE_ARRAY || t == TYPE_MAP) {
-		return
+
+	return
+}
+
+// child returns the value that starts at offset within obj's data.
+func (obj *MarshalledObject) child(offset int) *MarshalledObject {
+	if offset > len(obj.data) {
+		offset = len(obj.data)
 	}
 
-	cache := *(obj.objectCache)
+	v := newMarshalledObject(obj.MajorVersion, obj.MinorVersion, obj.data[offset:], obj.symbolCache, obj.objectCache)
+	v.data = v.data[:v.getSize()]
+
+	return v
+}
+
+func (obj *MarshalledObject) getSize() int {
+	if obj.size == 0 {
+		s := &scanner{data: obj.data}
 
-	for _, o := range cache {
-		if object == o {
-			return
+		if err := s.value(); err != nil {
+			obj.size = len(obj.data)
+		} else {
+			obj.size = s.pos
 		}
 	}
-	cache = append(cache, object)
 
-	*(obj.objectCache) = cache
+	return obj.size
+}
+
+// complete reports whether the data of obj holds a whole value, which
+// corrupted or truncated dumps may not.
+func (obj *MarshalledObject) complete() bool {
+	s := &scanner{data: obj.data}
+
+	return s.value() == nil
 }
 
 func (obj *MarshalledObject) ToString() (str string) {
@@ -364,11 +342,11 @@ func (obj *MarshalledObject) ToString() (str string) {
 }
 
 func (obj *MarshalledObject) resolveObjectLink() *MarshalledObject {
-	if len(obj.data) > 0 && obj.data[0] == '@' {
+	if len(obj.data) > 1 && obj.data[0] == '@' && obj.complete() {
 		idx, _ := parseInt(obj.data[1:])
 		cache := *(obj.objectCache)
 
-		if int(idx) < len(cache) {
+		if idx >= 0 && int(idx) < len(cache) {
 			return cache[idx]
 		}
 	}
@@ -410,39 +388,38 @@ func parseInt(data []byte) (int64, int) {
 	}
 }
 
-func parseString(data []byte) (string, int) {
-	length, header_size := parseInt(data)
-	size := int(length) + header_size
+func parseBignum(data []byte) (int64, error) {
+	length, offset := parseInt(data[1:])
+	offset += 1
 
-  return string(data[header_size : size]), size
-}
+	var value uint64
+	for i := int(length)*2 - 1; i >= 0; i-- {
+		if value>>56 != 0 {
+			return 0, IntegerOverflow
+		}
+		value = value<<8 | uint64(data[offset+i])
+	}
 
-func parseStringWithEncoding(data []byte) (string, int, []string) {
-	cache := make([]string, 0)
-  value, size := parseString(data)
-
-  if len(data) > size+1 && (data[size+1] == ':' || data[size+1] == ';') {
-    if data[size+1] == ';' {
-      _, enc_size := parseInt(data[size+2:])
-      size += enc_size + 1
-    } else {
-      enc_symbol, enc_size := parseString(data[size+2:])
-      size += enc_size + 1
-      cache = append(cache, enc_symbol)
-    }
-
-    if data[size+1] == '"' {
-      encoding, enc_name_size := parseString(data[size+2:])
-      _ = encoding
-      size += enc_name_size + 1
-		} else {
-			_, enc_name_size := parseBool(data[size+1:])
-			size += enc_name_size
+	if data[0] == '-' {
+		if value > 1<<63 {
+			return 0, IntegerOverflow
 		}
+		return -int64(value), nil
+	}
 
-		size += 1
+	if value >= 1<<63 {
+		return 0, IntegerOverflow
 	}
 
+	return int64(value), nil
+}
+
+func parseString(data []byte) (string, int) {
+	length, header_size := parseInt(data)
+	size := int(length) + header_size
+	if size > len(data) || size < header_size {
+		size = len(data)
+	}
 
-	return value, size, cache
+	return string(data[header_size:size]), size
 }
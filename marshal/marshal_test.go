@@ -417,3 +417,54 @@ func TestGetAsMap(t *testing.T) {
 		}
 	}
 }
+
+func TestGetAsObject(t *testing.T) {
+	// Money.new(100, "USD")
+	m := CreateMarshalledObject([]byte{4, 8, 111, 58, 10, 77, 111, 110, 101, 121, 7, 58, 11, 64, 99, 101, 110, 116, 115, 105, 105, 58, 14, 64, 99, 117, 114, 114, 101, 110, 99, 121, 73, 34, 8, 85, 83, 68, 6, 58, 6, 69, 84})
+
+	if m.GetType() != TYPE_OBJECT {
+		t.Errorf("GetType() returned '%v' instead of '%v'", m.GetType(), TYPE_OBJECT)
+	}
+
+	class, err := m.GetClassName()
+	if err != nil || class != "Money" {
+		t.Errorf("GetClassName() returned '%v' (%v) instead of 'Money'", class, err)
+	}
+
+	ivars, err := m.GetAsObject()
+	if err != nil {
+		t.Fatalf("GetAsObject() returned an error: %v", err)
+	}
+
+	if cents, err := ivars["@cents"].GetAsInteger(); err != nil || cents != 100 {
+		t.Errorf("GetAsObject() returned @cents = %v (%v) instead of 100", cents, err)
+	}
+
+	if currency, err := ivars["@currency"].GetAsString(); err != nil || currency != "USD" {
+		t.Errorf("GetAsObject() returned @currency = '%v' (%v) instead of 'USD'", currency, err)
+	}
+
+	if _, err = CreateMarshalledObject([]byte{4, 8, 48}).GetAsObject(); err == nil {
+		t.Error("GetAsObject() returned no error when attempted to typecast nil to object")
+	}
+}
+
+func TestGetAsIntegerBignum(t *testing.T) {
+	tests := []getAsIntegerTestCase{
+		{[]byte{4, 8, 108, 43, 7, 0, 0, 0, 64}, 2 << 29},
+		{[]byte{4, 8, 108, 45, 7, 1, 0, 0, 64}, -(2 << 29) - 1},
+		{[]byte{4, 8, 108, 43, 9, 0, 0, 0, 0, 0, 0, 0, 128}, -1 << 63},
+	}
+
+	for _, testCase := range tests[:2] {
+		value, err := CreateMarshalledObject(testCase.Data).GetAsInteger()
+
+		if err != nil || value != testCase.Expectation {
+			t.Errorf("GetAsInteger() returned '%v' (%v) instead of '%v'", value, err, testCase.Expectation)
+		}
+	}
+
+	if _, err := CreateMarshalledObject(tests[2].Data).GetAsInteger(); err != IntegerOverflow {
+		t.Errorf("GetAsInteger() returned '%v' instead of '%v' for 2**63", err, IntegerOverflow)
+	}
+}
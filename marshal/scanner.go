@@ -0,0 +1,437 @@
+package marshal
+
+import (
+	"io"
+)
+
+// Upper bound for a single read from the underlying stream, so that a bogus
+// length prefix cannot make the scanner allocate more than it actually reads.
+const scannerChunkSize = 64 * 1024
+
+type span struct {
+	start, end int
+}
+
+// scanner walks the structure of marshalled data without decoding values.
+// It is used to find where a value ends and, when record is set, to build
+// the symbol and object tables in the same order Ruby's Marshal.load does.
+//
+// If src is set, data is read from it on demand, exactly as many bytes as
+// the structure requires.
+type scanner struct {
+	data []byte
+	pos  int
+	src  io.Reader
+
+	maxSize  int
+	maxDepth int
+	nesting  int
+
+	record  bool
+	symbols []string
+	objects []span
+
+	annotate    bool
+	depth       int
+	annotations []Annotation
+	marks       []annotationMark
+}
+
+func (s *scanner) need(n int) error {
+	if s.maxSize > 0 && n > s.maxSize-s.pos {
+		return LimitExceeded
+	}
+
+	for len(s.data)-s.pos < n {
+		if s.src == nil {
+			return IncompleteData
+		}
+
+		missing := n - (len(s.data) - s.pos)
+		if missing > scannerChunkSize {
+			missing = scannerChunkSize
+		}
+
+		l := len(s.data)
+		s.data = append(s.data, make([]byte, missing)...)
+		read, err := io.ReadFull(s.src, s.data[l:])
+		s.data = s.data[:l+read]
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return IncompleteData
+		} else if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *scanner) readByte() (byte, error) {
+	if err := s.need(1); err != nil {
+		return 0, err
+	}
+	s.pos++
+
+	return s.data[s.pos-1], nil
+}
+
+func (s *scanner) readInt() (int64, error) {
+	if err := s.need(1); err != nil {
+		return 0, err
+	}
+
+	size := 1
+	if c := s.data[s.pos]; c <= 0x05 {
+		size += int(c)
+	} else if c >= 0xfb {
+		size += int(0xff - c + 1)
+	}
+	if err := s.need(size); err != nil {
+		return 0, err
+	}
+
+	value, _ := parseInt(s.data[s.pos:])
+	s.pos += size
+
+	return value, nil
+}
+
+func (s *scanner) readLength() (int, error) {
+	length, err := s.readInt()
+	if err != nil {
+		return 0, err
+	}
+	if length < 0 || int64(int(length)) != length {
+		return 0, MalformedData
+	}
+
+	return int(length), nil
+}
+
+func (s *scanner) readBytes() ([]byte, error) {
+	length, err := s.readLength()
+	if err != nil {
+		return nil, err
+	}
+	if err = s.need(length); err != nil {
+		return nil, err
+	}
+	s.pos += length
+
+	return s.data[s.pos-length : s.pos], nil
+}
+
+func (s *scanner) register(start int) int {
+	s.objects = append(s.objects, span{start, -1})
+
+	return len(s.objects) - 1
+}
+
+func (s *scanner) dump() error {
+	if err := s.need(2); err != nil {
+		return err
+	}
+	s.pos += 2
+
+	return s.value()
+}
+
+func (s *scanner) symbol() (string, error) {
+	if !s.annotate {
+		return s.scanSymbol()
+	}
+
+	i := s.beginAnnotation()
+	sym, err := s.scanSymbol()
+	s.endAnnotation(i, err)
+
+	return sym, err
+}
+
+func (s *scanner) scanSymbol() (string, error) {
+	c, err := s.readByte()
+	if err != nil {
+		return "", err
+	}
+
+	switch c {
+	case ':':
+		b, err := s.readBytes()
+		if err != nil {
+			return "", err
+		}
+		if s.record {
+			s.symbols = append(s.symbols, string(b))
+		}
+
+		return string(b), nil
+	case ';':
+		idx, err := s.readInt()
+		if err != nil {
+			return "", err
+		}
+		if !s.record {
+			return "", nil
+		}
+		if idx < 0 || idx >= int64(len(s.symbols)) {
+			return "", MalformedData
+		}
+
+		return s.symbols[idx], nil
+	case 'I':
+		if err = s.need(1); err != nil {
+			return "", err
+		}
+		if s.data[s.pos] != ':' {
+			return "", MalformedData
+		}
+
+		sym, err := s.symbol()
+		if err != nil {
+			return "", err
+		}
+
+		return sym, s.ivars()
+	}
+
+	return "", MalformedData
+}
+
+func (s *scanner) ivars() error {
+	count, err := s.readLength()
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < count; i++ {
+		if _, err = s.symbol(); err != nil {
+			return err
+		}
+		if err = s.value(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *scanner) values(count int) error {
+	for i := 0; i < count; i++ {
+		if err := s.value(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *scanner) value() error {
+	if s.maxDepth > 0 {
+		if s.nesting >= s.maxDepth {
+			return LimitExceeded
+		}
+
+		s.nesting++
+		defer func() { s.nesting-- }()
+	}
+
+	if !s.annotate {
+		return s.scanValue()
+	}
+
+	i := s.beginAnnotation()
+	err := s.scanValue()
+	s.endAnnotation(i, err)
+
+	return err
+}
+
+func (s *scanner) scanValue() (err error) {
+	start := s.pos
+
+	c, err := s.readByte()
+	if err != nil {
+		return
+	}
+
+	switch c {
+	case '0', 'T', 'F':
+		return
+	case 'i':
+		_, err = s.readInt()
+		return
+	case ':', ';':
+		s.pos = start
+		_, err = s.scanSymbol()
+		return
+	case '@':
+		var idx int64
+		if idx, err = s.readInt(); err != nil {
+			return
+		}
+		if s.record && (idx < 0 || idx >= int64(len(s.objects))) {
+			err = MalformedData
+		}
+		return
+	case 'I', 'e', 'C':
+		// Wrappers: the object table entry belongs to the wrapped value,
+		// but a link to it has to resolve to the wrapper as a whole.
+		if c != 'I' {
+			if _, err = s.symbol(); err != nil {
+				return
+			}
+		}
+
+		n := len(s.objects)
+		if err = s.value(); err != nil {
+			return
+		}
+
+		if c == 'I' {
+			if err = s.ivars(); err != nil {
+				return
+			}
+		}
+
+		if len(s.objects) > n {
+			s.objects[n] = span{start, s.pos}
+		}
+		return
+	}
+
+	idx := s.register(start)
+
+	switch c {
+	case 'f', '"', 'c', 'm', 'M':
+		_, err = s.readBytes()
+	case '/':
+		if _, err = s.readBytes(); err == nil {
+			_, err = s.readByte()
+		}
+	case 'l':
+		var length int
+		if _, err = s.readByte(); err != nil {
+			break
+		}
+		if length, err = s.readLength(); err != nil {
+			break
+		}
+		if length *= 2; length < 0 {
+			err = MalformedData
+		} else if err = s.need(length); err == nil {
+			s.pos += length
+		}
+	case '[':
+		var count int
+		if count, err = s.readLength(); err == nil {
+			err = s.values(count)
+		}
+	case '{', '}':
+		var count int
+		if count, err = s.readLength(); err != nil {
+			break
+		}
+		for i := 0; i < count && err == nil; i++ {
+			if err = s.value(); err == nil {
+				err = s.value()
+			}
+		}
+		if err == nil && c == '}' {
+			err = s.value()
+		}
+	case 'o', 'S':
+		if _, err = s.symbol(); err == nil {
+			err = s.ivars()
+		}
+	case 'u':
+		if _, err = s.symbol(); err == nil {
+			_, err = s.readBytes()
+		}
+	case 'U', 'd':
+		if _, err = s.symbol(); err == nil {
+			err = s.value()
+		}
+	default:
+		err = MalformedData
+	}
+
+	if err == nil {
+		s.objects[idx].end = s.pos
+	}
+
+	return
+}
+
+type annotationMark struct {
+	symbols, objects int
+}
+
+func (s *scanner) beginAnnotation() int {
+	s.annotations = append(s.annotations, Annotation{
+		Offset: s.pos,
+		Depth:  s.depth,
+		Symbol: -1,
+		Object: -1,
+	})
+	s.marks = append(s.marks, annotationMark{len(s.symbols), len(s.objects)})
+	s.depth++
+
+	return len(s.annotations) - 1
+}
+
+func (s *scanner) endAnnotation(i int, err error) {
+	s.depth--
+
+	a, mark := &s.annotations[i], s.marks[i]
+	a.Bytes = s.data[a.Offset:s.pos]
+	a.Incomplete = err != nil
+	if len(a.Bytes) > 0 {
+		a.Type = a.Bytes[0]
+	}
+
+	switch a.Type {
+	case ':':
+		if len(s.symbols) > mark.symbols {
+			a.Symbol = mark.symbols
+		}
+	case ';', '@':
+		if len(a.Bytes) > 1 && !a.Incomplete {
+			idx, _ := parseInt(a.Bytes[1:])
+			if a.Type == ';' {
+				a.Symbol = int(idx)
+			} else {
+				a.Object = int(idx)
+			}
+		}
+	default:
+		if len(s.objects) > mark.objects && s.objects[mark.objects].start == a.Offset {
+			a.Object = mark.objects
+		}
+	}
+}
+
+// marshalledObject builds an object for the scanned dump, with the symbol
+// and object tables shared by all of its nested values.
+func (s *scanner) marshalledObject() *MarshalledObject {
+	var major, minor byte
+	if len(s.data) > 1 {
+		major, minor = s.data[0], s.data[1]
+	}
+
+	symbols := s.symbols
+	objects := make([]*MarshalledObject, len(s.objects))
+	for i, sp := range s.objects {
+		end := sp.end
+		if end < 0 {
+			end = len(s.data)
+		}
+		objects[i] = newMarshalledObject(major, minor, s.data[sp.start:end], &symbols, &objects)
+	}
+
+	if len(s.data) < 2 {
+		return newMarshalledObject(major, minor, nil, &symbols, &objects)
+	}
+
+	return newMarshalledObject(major, minor, s.data[2:], &symbols, &objects)
+}
@@ -0,0 +1,270 @@
+package marshal
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Schema describes the expected shape of a value, so that untrusted data
+// such as a session can be checked in one place before it is used:
+//
+//	var sessionSchema = marshal.Schema{
+//		Type: marshal.TYPE_MAP,
+//		Keys: map[string]marshal.Schema{
+//			"session_id": {Type: marshal.TYPE_STRING, MinLength: 32, MaxLength: 32},
+//			"warden.user.user.key": {Type: marshal.TYPE_ARRAY, Items: []marshal.Schema{
+//				{Type: marshal.TYPE_ARRAY, Items: []marshal.Schema{{Type: marshal.TYPE_INTEGER}}},
+//				{Type: marshal.TYPE_STRING},
+//			}},
+//		},
+//	}
+//
+// Zero fields are not checked, so the zero Schema accepts any value.
+type Schema struct {
+	// Type is the expected type as returned by GetType, except that Sets
+	// are arrays and OpenStructs hashes. Nil is accepted if Nullable is set.
+	Type     marshalledObjectType
+	Nullable bool
+	// Class is the expected Ruby class, e.g. "User".
+	Class string
+
+	// MinLength and MaxLength bound the number of characters of a string and
+	// the number of elements or entries of an array or hash. A MaxLength of 0
+	// means no limit.
+	MinLength, MaxLength int
+	// Pattern has to match strings.
+	Pattern *regexp.Regexp
+
+	// Items are the schemas of the elements of an array of that length.
+	Items []Schema
+	// Elem is the schema of the elements of an array, and of the entries of
+	// a hash not listed in Keys or Optional.
+	Elem *Schema
+
+	// Keys and Optional are the schemas of required and optional entries of
+	// a hash or instance variables of an object, named without the "@".
+	// Hash keys are matched by GetAsMap's rules.
+	Keys, Optional map[string]Schema
+	// Strict rejects entries not listed in Keys or Optional if Elem is nil.
+	Strict bool
+
+	// Check is called for values passing all other checks and returns an
+	// error describing a violation.
+	Check func(obj *MarshalledObject) error
+}
+
+// A Violation is a single way in which a value does not match a Schema.
+type Violation struct {
+	// Path addresses the value like Difference.Path does.
+	Path    string
+	Message string
+}
+
+func (v Violation) String() string {
+	path := v.Path
+	if path == "" {
+		path = "(root)"
+	}
+
+	return path + ": " + v.Message
+}
+
+// Validate returns all violations of s by obj, or nil if obj matches s.
+func (s Schema) Validate(obj *MarshalledObject) []Violation {
+	v := &validator{seen: make(map[schemaVisit]bool)}
+	v.validate("", &s, obj)
+
+	return v.violations
+}
+
+type schemaVisit struct {
+	schema *Schema
+	data   *byte
+}
+
+type validator struct {
+	violations []Violation
+	seen       map[schemaVisit]bool
+}
+
+func (v *validator) add(path string, format string, args ...interface{}) {
+	v.violations = append(v.violations, Violation{path, fmt.Sprintf(format, args...)})
+}
+
+var schemaTypeNames = map[marshalledObjectType]string{
+	TYPE_NIL:     "nil",
+	TYPE_BOOL:    "a boolean",
+	TYPE_INTEGER: "an integer",
+	TYPE_FLOAT:   "a float",
+	TYPE_STRING:  "a string",
+	TYPE_ARRAY:   "an array",
+	TYPE_MAP:     "a hash",
+	TYPE_OBJECT:  "an object",
+}
+
+func (v *validator) validate(path string, s *Schema, obj *MarshalledObject) {
+	obj = obj.unwrap()
+
+	typ := obj.GetType()
+	elements, err := obj.GetAsSet()
+	if err == nil {
+		typ = TYPE_ARRAY
+	} else if typ == TYPE_ARRAY {
+		elements, _ = obj.GetAsArray()
+	}
+
+	openStruct, err := obj.GetAsOpenStruct()
+	if err == nil {
+		typ = TYPE_MAP
+	}
+
+	if typ == TYPE_NIL && (s.Nullable || s.Type == TYPE_UNKNOWN) {
+		return
+	}
+
+	if s.Type != TYPE_UNKNOWN && typ != s.Type {
+		v.add(path, "expected %s, got %s", schemaTypeNames[s.Type], obj.rubyClass())
+		return
+	}
+	if s.Class != "" && obj.rubyClass() != s.Class {
+		v.add(path, "expected an instance of %s, got %s", s.Class, obj.rubyClass())
+		return
+	}
+
+	// Values can only be reached recursively through containers, and a
+	// recursive schema only needs to be checked once for each of them.
+	switch typ {
+	case TYPE_ARRAY, TYPE_MAP, TYPE_OBJECT:
+		visit := schemaVisit{s, &obj.data[0]}
+		if v.seen[visit] {
+			return
+		}
+		v.seen[visit] = true
+	}
+
+	valid := len(v.violations)
+
+	switch typ {
+	case TYPE_STRING:
+		str, _ := obj.GetAsString()
+		v.checkLength(path, utf8.RuneCountInString(str), s)
+
+		if s.Pattern != nil && !s.Pattern.MatchString(str) {
+			v.add(path, "%s does not match /%s/", obj.Inspect(), s.Pattern)
+		}
+	case TYPE_ARRAY:
+		v.checkLength(path, len(elements), s)
+
+		if s.Items != nil && len(elements) != len(s.Items) {
+			v.add(path, "expected %d elements, got %d", len(s.Items), len(elements))
+			break
+		}
+
+		for i, element := range elements {
+			p := fmt.Sprintf("%s[%d]", path, i)
+
+			switch {
+			case s.Items != nil:
+				v.validate(p, &s.Items[i], element)
+			case s.Elem != nil:
+				v.validate(p, s.Elem, element)
+			}
+		}
+	case TYPE_MAP, TYPE_OBJECT:
+		entries := schemaEntries(obj, openStruct)
+		v.checkLength(path, len(entries), s)
+
+		present := make(map[string]bool, len(entries))
+		for _, e := range entries {
+			present[e.name] = true
+
+			if schema, ok := s.Keys[e.name]; ok {
+				v.validate(path+e.path, &schema, e.value)
+			} else if schema, ok := s.Optional[e.name]; ok {
+				v.validate(path+e.path, &schema, e.value)
+			} else if s.Elem != nil {
+				v.validate(path+e.path, s.Elem, e.value)
+			} else if s.Strict {
+				v.add(path+e.path, "unexpected entry")
+			}
+		}
+
+		for _, name := range sortedSchemaKeys(s.Keys) {
+			if present[name] {
+				continue
+			}
+
+			if typ == TYPE_OBJECT && openStruct == nil {
+				v.add(path+".@"+name, "missing")
+			} else {
+				v.add(path+"["+strconv.Quote(name)+"]", "missing")
+			}
+		}
+	}
+
+	if s.Check != nil && len(v.violations) == valid {
+		if err := s.Check(obj); err != nil {
+			v.add(path, "%v", err)
+		}
+	}
+}
+
+func (v *validator) checkLength(path string, n int, s *Schema) {
+	if n < s.MinLength {
+		v.add(path, "length %d is less than %d", n, s.MinLength)
+	}
+	if s.MaxLength > 0 && n > s.MaxLength {
+		v.add(path, "length %d is greater than %d", n, s.MaxLength)
+	}
+}
+
+type schemaEntry struct {
+	name  string // as listed in Schema.Keys
+	path  string
+	value *MarshalledObject
+}
+
+func schemaEntries(obj *MarshalledObject, openStruct map[string]*MarshalledObject) []schemaEntry {
+	var entries []schemaEntry
+
+	switch {
+	case openStruct != nil:
+		for _, name := range sortedObjectKeys(openStruct) {
+			entries = append(entries, schemaEntry{name, "[:" + name + "]", openStruct[name]})
+		}
+	case obj.GetType() == TYPE_MAP:
+		for _, p := range obj.hashPairs() {
+			entries = append(entries, schemaEntry{p.key.ToString(), "[" + p.name + "]", p.value})
+		}
+	default:
+		for _, p := range obj.objectPairs() {
+			entries = append(entries, schemaEntry{strings.TrimPrefix(p.name, "@"), "." + p.name, p.value})
+		}
+	}
+
+	return entries
+}
+
+func sortedSchemaKeys(m map[string]Schema) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func sortedObjectKeys(m map[string]*MarshalledObject) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,136 @@
+package marshal
+
+import (
+	"errors"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+type schemaTestCase struct {
+	Value       interface{}
+	Expectation []string
+}
+
+func TestSchemaValidate(t *testing.T) {
+	schema := Schema{
+		Type: TYPE_MAP,
+		Keys: map[string]Schema{
+			"session_id": {Type: TYPE_STRING, MinLength: 32, MaxLength: 32},
+			"warden.user.user.key": {Type: TYPE_ARRAY, Items: []Schema{
+				{Type: TYPE_ARRAY, Items: []Schema{{Type: TYPE_INTEGER}}},
+				{Type: TYPE_STRING},
+			}},
+		},
+		Optional: map[string]Schema{
+			"_csrf_token": {Type: TYPE_STRING, Pattern: regexp.MustCompile(`^[A-Za-z0-9+/]+={0,2}$`)},
+			"flash":       {Type: TYPE_MAP, Nullable: true, Elem: &Schema{Type: TYPE_STRING}},
+			"user":        {Type: TYPE_OBJECT, Class: "User", Keys: map[string]Schema{"id": {Type: TYPE_INTEGER}}},
+		},
+		Strict: true,
+	}
+
+	sessionID := "b85897340bfedc7e03b7e9479c271439"
+
+	tests := []schemaTestCase{
+		{
+			Hash{
+				{"session_id", sessionID},
+				{"warden.user.user.key", []interface{}{[]int{1}, "$2a$11$6omJ7"}},
+				{"_csrf_token", "q3NtZ2FFmA=="},
+				{"flash", nil},
+				{"user", Object{Class: "User", Ivars: map[string]interface{}{"@id": 1}}},
+			},
+			nil,
+		},
+		{
+			// symbol keys match too
+			Hash{{Symbol("session_id"), sessionID}, {Symbol("warden.user.user.key"), []interface{}{[]int{1}, "x"}}},
+			nil,
+		},
+		{
+			Hash{
+				{"session_id", "abc"},
+				{"warden.user.user.key", []interface{}{[]string{"1"}, 2}},
+				{"_csrf_token", "not base64!"},
+				{"flash", Hash{{"notice", 1}}},
+				{Symbol("extra"), true},
+			},
+			[]string{
+				`["session_id"]: length 3 is less than 32`,
+				`["warden.user.user.key"][0][0]: expected an integer, got String`,
+				`["warden.user.user.key"][1]: expected a string, got Integer`,
+				`["_csrf_token"]: "not base64!" does not match /^[A-Za-z0-9+/]+={0,2}$/`,
+				`["flash"]["notice"]: expected a string, got Integer`,
+				`[:extra]: unexpected entry`,
+			},
+		},
+		{
+			Hash{
+				{"warden.user.user.key", []interface{}{[]int{1, 2}}},
+				{"user", Object{Class: "Admin", Ivars: map[string]interface{}{"@id": 1}}},
+			},
+			[]string{
+				`["warden.user.user.key"]: expected 2 elements, got 1`,
+				`["user"]: expected an instance of User, got Admin`,
+				`["session_id"]: missing`,
+			},
+		},
+		{
+			Hash{
+				{"session_id", sessionID},
+				{"warden.user.user.key", []interface{}{[]int{1}, "x"}},
+				{"user", Object{Class: "User", Ivars: map[string]interface{}{}}},
+			},
+			[]string{`["user"].@id: missing`},
+		},
+		{[]int{1}, []string{"(root): expected a hash, got Array"}},
+		{nil, []string{"(root): expected a hash, got NilClass"}},
+	}
+
+	for _, testCase := range tests {
+		data, err := Marshal(testCase.Value)
+		if err != nil {
+			t.Fatalf("Marshal(%#v) returned error %v", testCase.Value, err)
+		}
+
+		var violations []string
+		for _, v := range schema.Validate(CreateMarshalledObject(data)) {
+			violations = append(violations, v.String())
+		}
+
+		if !reflect.DeepEqual(violations, testCase.Expectation) {
+			t.Errorf("Validate(%v) returned %q instead of %q", testCase.Value, violations, testCase.Expectation)
+		}
+	}
+}
+
+func TestSchemaValidateCheck(t *testing.T) {
+	positive := Schema{Type: TYPE_INTEGER, Check: func(obj *MarshalledObject) error {
+		if i, _ := obj.GetAsInteger(); i <= 0 {
+			return errors.New("not positive")
+		}
+		return nil
+	}}
+
+	if v := positive.Validate(CreateMarshalledObject([]byte{4, 8, 105, 6})); v != nil {
+		t.Errorf("Validate(1) returned %v instead of nil", v)
+	}
+
+	expected := []Violation{{"", "not positive"}}
+	if v := positive.Validate(CreateMarshalledObject([]byte{4, 8, 105, 0})); !reflect.DeepEqual(v, expected) {
+		t.Errorf("Validate(0) returned %v instead of %v", v, expected)
+	}
+}
+
+func TestSchemaValidateRecursive(t *testing.T) {
+	// a = []; a << a
+	data := []byte{4, 8, 91, 6, 64, 0}
+
+	schema := Schema{Type: TYPE_ARRAY}
+	schema.Elem = &schema
+
+	if v := schema.Validate(CreateMarshalledObject(data)); v != nil {
+		t.Errorf("Validate(a) returned %v instead of nil", v)
+	}
+}
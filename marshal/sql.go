@@ -0,0 +1,82 @@
+package marshal
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/base64"
+	"errors"
+	"io"
+	"strings"
+)
+
+var InvalidColumnValue = errors.New("gorails/marshal: column value is not a Marshal dump")
+
+// Column makes database columns holding Marshal dumps, e.g. of attributes
+// declared with `serialize :data, coder: Marshal`, usable with database/sql:
+//
+//	var prefs map[string]interface{}
+//	err := row.Scan(&id, &marshal.Column{V: &prefs})
+//
+//	_, err = db.Exec("UPDATE users SET prefs = ? WHERE id = ?", marshal.Column{V: prefs}, id)
+//
+// Scan decodes the column into V with Unmarshal, so V must be a pointer. NULL
+// is decoded like a dump of nil. Dumps wrapped in base64, as written by some
+// coders to store them in text columns, are detected and unwrapped, in which
+// case Base64 is set.
+//
+// Value encodes V with Marshal and wraps the dump in base64 if Base64 is set.
+type Column struct {
+	V      interface{}
+	Base64 bool
+}
+
+// Scan implements the database/sql.Scanner interface.
+func (c *Column) Scan(src interface{}) error {
+	var data []byte
+	switch s := src.(type) {
+	case nil:
+		data = []byte{majorVersion, minorVersion, '0'}
+	case []byte:
+		// The driver may reuse src, which the decoded value refers to.
+		data = append([]byte(nil), s...)
+	case string:
+		data = []byte(s)
+	default:
+		return InvalidColumnValue
+	}
+
+	c.Base64 = false
+	if !bytes.HasPrefix(data, []byte{majorVersion, minorVersion}) {
+		// Base64.encode64 breaks lines after 60 characters.
+		decoded, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(data)), ""))
+		if err != nil || !bytes.HasPrefix(decoded, []byte{majorVersion}) {
+			return InvalidColumnValue
+		}
+
+		data, c.Base64 = decoded, true
+	}
+
+	obj, err := NewDecoder(bytes.NewReader(data)).Decode()
+	if err == io.EOF {
+		return InvalidColumnValue
+	}
+	if err != nil {
+		return err
+	}
+
+	return obj.Unmarshal(c.V)
+}
+
+// Value implements the database/sql/driver.Valuer interface.
+func (c Column) Value() (driver.Value, error) {
+	data, err := Marshal(c.V)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Base64 {
+		return base64.StdEncoding.EncodeToString(data), nil
+	}
+
+	return data, nil
+}
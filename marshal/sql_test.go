@@ -0,0 +1,162 @@
+package marshal
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+// fakeDriver is a database/sql driver with a single table of one column.
+// Statements starting with "INSERT" append their argument to the table, any
+// other statement returns all rows.
+type fakeDriver struct {
+	rows []driver.Value
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) { return &fakeConn{d}, nil }
+
+type fakeConn struct{ d *fakeDriver }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) { return &fakeStmt{c.d, query}, nil }
+func (c *fakeConn) Close() error                              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions are not supported")
+}
+
+type fakeStmt struct {
+	d     *fakeDriver
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.d.rows = append(s.d.rows, args[0])
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return &fakeRows{rows: s.d.rows}, nil
+}
+
+type fakeRows struct {
+	rows []driver.Value
+	next int
+}
+
+func (r *fakeRows) Columns() []string { return []string{"data"} }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next == len(r.rows) {
+		return io.EOF
+	}
+
+	dest[0] = r.rows[r.next]
+	r.next++
+
+	return nil
+}
+
+var fake = &fakeDriver{}
+
+func init() {
+	sql.Register("gorails-marshal-fake", fake)
+}
+
+type columnPrefs struct {
+	Theme string   `ruby:"theme,symbol"`
+	Tags  []string `ruby:"tags"`
+}
+
+func TestColumn(t *testing.T) {
+	db, err := sql.Open("gorails-marshal-fake", "")
+	if err != nil {
+		t.Fatalf("sql.Open() returned an error: %v", err)
+	}
+	defer db.Close()
+
+	fake.rows = nil
+	prefs := columnPrefs{Theme: "dark", Tags: []string{"a", "b"}}
+
+	for _, c := range []Column{{V: prefs}, {V: prefs, Base64: true}, {V: nil}} {
+		if _, err := db.Exec("INSERT", c); err != nil {
+			t.Fatalf("Exec() returned an error: %v", err)
+		}
+	}
+	if _, err := db.Exec("INSERT", nil); err != nil {
+		t.Fatalf("Exec() returned an error: %v", err)
+	}
+
+	if _, ok := fake.rows[1].(string); !ok {
+		t.Errorf("Value() returned %T instead of a base64 string", fake.rows[1])
+	}
+
+	rows, err := db.Query("SELECT")
+	if err != nil {
+		t.Fatalf("Query() returned an error: %v", err)
+	}
+	defer rows.Close()
+
+	expectations := []columnPrefs{prefs, prefs, {}, {}}
+	base64Wrapped := []bool{false, true, false, false}
+
+	var i int
+	for ; rows.Next(); i++ {
+		var scanned columnPrefs
+		c := Column{V: &scanned}
+
+		if err := rows.Scan(&c); err != nil {
+			t.Errorf("Scan() returned an error for row #%d: %v", i, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(scanned, expectations[i]) {
+			t.Errorf("Scan() decoded %+v instead of %+v from row #%d", scanned, expectations[i], i)
+		}
+		if c.Base64 != base64Wrapped[i] {
+			t.Errorf("Scan() set Base64 to %v for row #%d", c.Base64, i)
+		}
+	}
+
+	if i != len(expectations) {
+		t.Errorf("Query() returned %d rows instead of %d", i, len(expectations))
+	}
+}
+
+type columnScanTestCase struct {
+	Src         interface{}
+	Expectation string
+	Err         error
+}
+
+func TestColumnScan(t *testing.T) {
+	tests := []columnScanTestCase{
+		{[]byte{4, 8, 105, 6}, "1", nil},
+		{"BAhpBg==", "1", nil},
+		// Base64.encode64 output
+		{base64.StdEncoding.EncodeToString([]byte{4, 8, 91, 6, 105, 6}) + "\n", "[1]", nil},
+		{nil, "nil", nil},
+		{"not a dump", "", InvalidColumnValue},
+		{42, "", InvalidColumnValue},
+		{[]byte{4, 8, 91}, "", IncompleteData},
+	}
+
+	for _, testCase := range tests {
+		var obj *MarshalledObject
+		err := (&Column{V: &obj}).Scan(testCase.Src)
+		if err != testCase.Err {
+			t.Errorf("Scan(%v) returned %v instead of %v", testCase.Src, err, testCase.Err)
+			continue
+		}
+
+		if err == nil && obj.Inspect() != testCase.Expectation {
+			t.Errorf("Scan(%v) decoded %s instead of %s", testCase.Src, obj.Inspect(), testCase.Expectation)
+		}
+	}
+}
@@ -0,0 +1,380 @@
+package marshal
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var InvalidUnmarshalTarget = errors.New("gorails/marshal: Unmarshal target must be a non-nil pointer")
+var RecursiveData = errors.New("gorails/marshal: value contains itself")
+
+// RubyUnmarshaler is implemented by types that decode a Ruby value
+// themselves, e.g. an object of a Ruby class with its own structure.
+type RubyUnmarshaler interface {
+	UnmarshalRuby(*MarshalledObject) error
+}
+
+// Unmarshal decodes the Ruby Marshal dump in data and stores the result in
+// the value pointed to by v.
+func Unmarshal(data []byte, v interface{}) error {
+	obj, err := NewDecoder(bytes.NewReader(data)).Decode()
+	if err == io.EOF {
+		return IncompleteData
+	}
+	if err != nil {
+		return err
+	}
+
+	return obj.Unmarshal(v)
+}
+
+// Unmarshal stores the value of obj in the value pointed to by v.
+//
+// Unmarshal uses the inverse of the mapping used by Marshal. Hashes can be
+// decoded into maps or structs. Objects are decoded like hashes of their
+// instance variables with the leading "@" stripped from the names. Sets are
+// decoded like arrays and OpenStructs like hashes of their attributes. Fields
+// of type *MarshalledObject receive the undecoded value. Types implementing
+// RubyUnmarshaler decode their values themselves.
+//
+// Decoding into an empty interface stores nil, bool, int64, float64, string,
+// []interface{} or map[string]interface{}.
+func (obj *MarshalledObject) Unmarshal(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return InvalidUnmarshalTarget
+	}
+
+	return obj.unmarshal(rv.Elem(), make(map[*byte]bool))
+}
+
+var (
+	rubyUnmarshalerType     = reflect.TypeOf((*RubyUnmarshaler)(nil)).Elem()
+	marshalledObjectPtrType = reflect.TypeOf((*MarshalledObject)(nil))
+)
+
+func (obj *MarshalledObject) unmarshal(v reflect.Value, seen map[*byte]bool) error {
+	if ref := obj.resolveObjectLink(); ref != nil {
+		return ref.unmarshal(v, seen)
+	}
+
+	if v.Type() == marshalledObjectPtrType {
+		v.Set(reflect.ValueOf(obj))
+		return nil
+	}
+
+	if v.Kind() != reflect.Ptr && v.CanAddr() && reflect.PtrTo(v.Type()).Implements(rubyUnmarshalerType) {
+		return v.Addr().Interface().(RubyUnmarshaler).UnmarshalRuby(obj)
+	}
+
+	object_type := obj.GetType()
+
+	if object_type == TYPE_NIL {
+		switch v.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+			v.Set(reflect.Zero(v.Type()))
+		}
+
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+
+		return obj.unmarshal(v.Elem(), seen)
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			return TypeMismatch
+		}
+
+		value, err := obj.toInterface(seen)
+		if err != nil {
+			return err
+		}
+		if value != nil {
+			v.Set(reflect.ValueOf(value))
+		}
+
+		return nil
+	}
+
+	if len(obj.data) == 0 {
+		return TypeMismatch
+	}
+
+	// Containers may be reached recursively through object links.
+	key := &obj.data[0]
+	if seen[key] {
+		return RecursiveData
+	}
+	seen[key] = true
+	defer delete(seen, key)
+
+	if value, err := obj.GetAsSet(); err == nil {
+		return unmarshalArray(v, value, seen)
+	}
+	if value, err := obj.GetAsOpenStruct(); err == nil {
+		return unmarshalMap(v, value, seen)
+	}
+
+	switch object_type {
+	case TYPE_BOOL:
+		if v.Kind() != reflect.Bool {
+			return TypeMismatch
+		}
+
+		value, _ := obj.GetAsBool()
+		v.SetBool(value)
+	case TYPE_INTEGER:
+		value, err := obj.GetAsInteger()
+		if err != nil {
+			return err
+		}
+
+		return setInteger(v, value)
+	case TYPE_FLOAT:
+		if v.Kind() != reflect.Float32 && v.Kind() != reflect.Float64 {
+			return TypeMismatch
+		}
+
+		value, err := obj.GetAsFloat()
+		if err != nil {
+			return err
+		}
+		v.SetFloat(value)
+	case TYPE_STRING:
+		value, _ := obj.GetAsString()
+
+		if v.Kind() == reflect.String {
+			v.SetString(value)
+		} else if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			v.SetBytes([]byte(value))
+		} else {
+			return TypeMismatch
+		}
+	case TYPE_ARRAY:
+		value, _ := obj.GetAsArray()
+
+		return unmarshalArray(v, value, seen)
+	case TYPE_MAP:
+		value, _ := obj.GetAsMap()
+
+		return unmarshalMap(v, value, seen)
+	case TYPE_OBJECT:
+		value, _ := obj.GetAsObject()
+
+		return unmarshalMap(v, stripIvarNames(value), seen)
+	default:
+		return TypeMismatch
+	}
+
+	return nil
+}
+
+func setInteger(v reflect.Value, value int64) error {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.OverflowInt(value) {
+			return IntegerOverflow
+		}
+		v.SetInt(value)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if value < 0 || v.OverflowUint(uint64(value)) {
+			return IntegerOverflow
+		}
+		v.SetUint(uint64(value))
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(float64(value))
+	default:
+		return TypeMismatch
+	}
+
+	return nil
+}
+
+func unmarshalArray(v reflect.Value, value []*MarshalledObject, seen map[*byte]bool) error {
+	switch v.Kind() {
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), len(value), len(value)))
+	case reflect.Array:
+		v.Set(reflect.Zero(v.Type()))
+	default:
+		return TypeMismatch
+	}
+
+	for i, item := range value {
+		if i >= v.Len() {
+			break
+		}
+
+		if err := item.unmarshal(v.Index(i), seen); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func unmarshalMap(v reflect.Value, value map[string]*MarshalledObject, seen map[*byte]bool) error {
+	switch v.Kind() {
+	case reflect.Map:
+		return unmarshalIntoMap(v, value, seen)
+	case reflect.Struct:
+		return unmarshalIntoStruct(v, value, seen)
+	}
+
+	return TypeMismatch
+}
+
+func unmarshalIntoMap(v reflect.Value, value map[string]*MarshalledObject, seen map[*byte]bool) error {
+	t := v.Type()
+	if v.IsNil() {
+		v.Set(reflect.MakeMap(t))
+	}
+
+	for k, item := range value {
+		key := reflect.New(t.Key()).Elem()
+
+		switch t.Key().Kind() {
+		case reflect.String:
+			key.SetString(k)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			i, err := strconv.ParseInt(k, 10, 64)
+			if err != nil {
+				return TypeMismatch
+			}
+			if err = setInteger(key, i); err != nil {
+				return err
+			}
+		default:
+			return TypeMismatch
+		}
+
+		elem := reflect.New(t.Elem()).Elem()
+		if err := item.unmarshal(elem, seen); err != nil {
+			return err
+		}
+
+		v.SetMapIndex(key, elem)
+	}
+
+	return nil
+}
+
+// Keys are matched against field names exactly first, then ignoring case.
+func unmarshalIntoStruct(v reflect.Value, value map[string]*MarshalledObject, seen map[*byte]bool) error {
+	fields := structFields(v.Type())
+
+	for k, item := range value {
+		index := -1
+		for _, f := range fields {
+			if f.name == k {
+				index = f.index
+				break
+			}
+			if index < 0 && strings.EqualFold(f.name, k) {
+				index = f.index
+			}
+		}
+
+		if index < 0 {
+			continue
+		}
+
+		if err := item.unmarshal(v.Field(index), seen); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func stripIvarNames(ivars map[string]*MarshalledObject) map[string]*MarshalledObject {
+	value := make(map[string]*MarshalledObject, len(ivars))
+	for k, v := range ivars {
+		value[strings.TrimPrefix(k, "@")] = v
+	}
+
+	return value
+}
+
+func (obj *MarshalledObject) toInterface(seen map[*byte]bool) (value interface{}, err error) {
+	if ref := obj.resolveObjectLink(); ref != nil {
+		return ref.toInterface(seen)
+	}
+	if len(obj.data) == 0 {
+		return nil, TypeMismatch
+	}
+
+	key := &obj.data[0]
+	if seen[key] {
+		return nil, RecursiveData
+	}
+	seen[key] = true
+	defer delete(seen, key)
+
+	if items, err := obj.GetAsSet(); err == nil {
+		return interfaceArray(items, seen)
+	}
+	if items, err := obj.GetAsOpenStruct(); err == nil {
+		return interfaceMap(items, seen)
+	}
+
+	switch obj.GetType() {
+	case TYPE_NIL:
+		return nil, nil
+	case TYPE_BOOL:
+		return obj.GetAsBool()
+	case TYPE_INTEGER:
+		return obj.GetAsInteger()
+	case TYPE_FLOAT:
+		return obj.GetAsFloat()
+	case TYPE_STRING:
+		return obj.GetAsString()
+	case TYPE_ARRAY:
+		items, _ := obj.GetAsArray()
+
+		return interfaceArray(items, seen)
+	case TYPE_MAP, TYPE_OBJECT:
+		var items map[string]*MarshalledObject
+		if obj.GetType() == TYPE_MAP {
+			items, _ = obj.GetAsMap()
+		} else {
+			items, _ = obj.GetAsObject()
+			items = stripIvarNames(items)
+		}
+
+		return interfaceMap(items, seen)
+	}
+
+	return nil, TypeMismatch
+}
+
+func interfaceArray(items []*MarshalledObject, seen map[*byte]bool) (value []interface{}, err error) {
+	value = make([]interface{}, len(items))
+	for i, item := range items {
+		if value[i], err = item.toInterface(seen); err != nil {
+			return nil, err
+		}
+	}
+
+	return value, nil
+}
+
+func interfaceMap(items map[string]*MarshalledObject, seen map[*byte]bool) (value map[string]interface{}, err error) {
+	value = make(map[string]interface{}, len(items))
+	for k, item := range items {
+		if value[k], err = item.toInterface(seen); err != nil {
+			return nil, err
+		}
+	}
+
+	return value, nil
+}
@@ -0,0 +1,160 @@
+package marshal
+
+import (
+	"reflect"
+	"testing"
+)
+
+var moneyData = []byte{4, 8, 111, 58, 10, 77, 111, 110, 101, 121, 7, 58, 11, 64, 99, 101, 110, 116, 115, 105, 105, 58, 14, 64, 99, 117, 114, 114, 101, 110, 99, 121, 73, 34, 8, 85, 83, 68, 6, 58, 6, 69, 84} // Money.new(100, "USD")
+
+type wallet struct {
+	Owner   string
+	Balance *money `ruby:"balance"`
+	Limit   int8   `ruby:"limit"`
+	Raw     *MarshalledObject
+}
+
+type account struct {
+	Cents    int64
+	Currency string
+}
+
+type unmarshalTestCase struct {
+	Data        []byte
+	Target      interface{}
+	Expectation interface{}
+}
+
+func TestUnmarshal(t *testing.T) {
+	tests := []unmarshalTestCase{
+		{[]byte{4, 8, 105, 6}, new(int), 1},
+		{[]byte{4, 8, 105, 6}, new(float64), 1.0},
+		{[]byte{4, 8, 108, 43, 8, 0, 0, 0, 0, 0, 1}, new(int64), int64(1 << 40)},
+		{[]byte{4, 8, 102, 8, 49, 46, 53}, new(float32), float32(1.5)},
+		{[]byte{4, 8, 84}, new(bool), true},
+		{[]byte{4, 8, 58, 10, 104, 101, 108, 108, 111}, new(string), "hello"},
+		{[]byte{4, 8, 73, 34, 8, 102, 111, 111, 6, 58, 6, 69, 84}, new([]byte), []byte("foo")},
+		{[]byte{4, 8, 48}, new(*int), (*int)(nil)},
+		{[]byte{4, 8, 105, 6}, new(*int), func() *int { i := 1; return &i }()},
+		{
+			[]byte{4, 8, 91, 8, 73, 34, 8, 102, 111, 111, 6, 58, 6, 69, 84, 73, 34, 8, 98, 97, 114, 6, 59, 0, 84, 58, 8, 98, 97, 122},
+			new([]string),
+			[]string{"foo", "bar", "baz"},
+		},
+		{[]byte{4, 8, 91, 7, 105, 6, 105, 7}, new([1]int), [1]int{1}},
+		{
+			[]byte{4, 8, 123, 8, 58, 6, 97, 123, 6, 73, 34, 6, 120, 6, 58, 6, 69, 84, 105, 6, 58, 6, 98, 64, 6, 58, 6, 99, 64, 6},
+			new(map[string]map[string]int),
+			map[string]map[string]int{"a": {"x": 1}, "b": {"x": 1}, "c": {"x": 1}},
+		},
+		{
+			[]byte{4, 8, 123, 7, 105, 6, 73, 34, 6, 120, 6, 58, 6, 69, 84, 105, 7, 48},
+			new(map[int]*string),
+			map[int]*string{1: func() *string { s := "x"; return &s }(), 2: nil},
+		},
+		{
+			[]byte{4, 8, 91, 7, 105, 6, 73, 34, 6, 120, 6, 58, 6, 69, 84},
+			new(interface{}),
+			[]interface{}{int64(1), "x"},
+		},
+		{moneyData, new(money), money{100, "USD"}},
+		{moneyData, new(account), account{100, "USD"}},
+		{moneyData, new(interface{}), map[string]interface{}{"cents": int64(100), "currency": "USD"}},
+	}
+
+	for _, testCase := range tests {
+		err := Unmarshal(testCase.Data, testCase.Target)
+
+		if err != nil {
+			t.Errorf("Unmarshal() returned an error: '%v' for %v", err.Error(), testCase.Data)
+		}
+
+		value := reflect.ValueOf(testCase.Target).Elem().Interface()
+		if !reflect.DeepEqual(value, testCase.Expectation) {
+			t.Errorf("Unmarshal() returned %#v instead of %#v", value, testCase.Expectation)
+		}
+	}
+}
+
+func TestUnmarshalStruct(t *testing.T) {
+	// {"owner" => "bob", :balance => Money.new(100, "USD"), "limit" => 5, "raw" => [1]}
+	data := []byte{4, 8, 123, 9,
+		73, 34, 10, 111, 119, 110, 101, 114, 6, 58, 6, 69, 84, 73, 34, 8, 98, 111, 98, 6, 59, 0, 84,
+		58, 12, 98, 97, 108, 97, 110, 99, 101,
+		111, 58, 10, 77, 111, 110, 101, 121, 7, 58, 11, 64, 99, 101, 110, 116, 115, 105, 105, 58, 14, 64, 99, 117, 114, 114, 101, 110, 99, 121, 73, 34, 8, 85, 83, 68, 6, 59, 0, 84,
+		73, 34, 10, 108, 105, 109, 105, 116, 6, 59, 0, 84, 105, 10,
+		73, 34, 8, 114, 97, 119, 6, 59, 0, 84, 91, 6, 105, 6,
+	}
+
+	var w wallet
+	if err := Unmarshal(data, &w); err != nil {
+		t.Fatalf("Unmarshal() returned an error: %v", err)
+	}
+
+	if w.Owner != "bob" || w.Limit != 5 {
+		t.Errorf("Unmarshal() returned %#v", w)
+	}
+
+	if w.Balance == nil || *w.Balance != (money{100, "USD"}) {
+		t.Errorf("Unmarshal() did not use UnmarshalRuby for %#v", w.Balance)
+	}
+
+	if raw, err := w.Raw.GetAsArray(); err != nil || len(raw) != 1 {
+		t.Errorf("Unmarshal() stored %v (%v) instead of the undecoded value", raw, err)
+	}
+}
+
+type unmarshalErrorTestCase struct {
+	Data        []byte
+	Target      interface{}
+	Expectation error
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	var i int
+
+	tests := []unmarshalErrorTestCase{
+		{[]byte{4, 8, 105, 6}, i, InvalidUnmarshalTarget},
+		{[]byte{4, 8, 105, 6}, (*int)(nil), InvalidUnmarshalTarget},
+		{[]byte{4, 8, 105, 6}, new(string), TypeMismatch},
+		{[]byte{4, 8, 105, 2, 0, 1}, new(int8), IntegerOverflow},
+		{[]byte{4, 8, 105, 250}, new(uint), IntegerOverflow},
+		{[]byte{4, 8, 108, 43, 10, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0}, new(int64), IntegerOverflow},
+		{[]byte{4, 8, 91, 0}, new(map[string]int), TypeMismatch},
+		{[]byte{4, 8, 123, 6, 105, 6, 105, 6}, new(map[bool]int), TypeMismatch},
+		{[]byte{4, 8, 105, 6}, new(money), TypeMismatch},
+		// a = []; a << a
+		{[]byte{4, 8, 91, 6, 64, 0}, new(interface{}), RecursiveData},
+		{[]byte{4, 8, 91, 6, 64, 0}, new([]interface{}), RecursiveData},
+		{[]byte{4, 8, 91, 6, 64, 0}, new([][]int), RecursiveData},
+		{[]byte{}, new(interface{}), IncompleteData},
+		{[]byte{4, 8, 105}, new(int), IncompleteData},
+		{[]byte{4, 8, 34}, new(string), IncompleteData},
+		{[]byte{4, 8, 111, 58, 6, 65}, new(interface{}), IncompleteData},
+		{[]byte{4, 8, 108, 43}, new(int64), IncompleteData},
+	}
+
+	for _, testCase := range tests {
+		if err := Unmarshal(testCase.Data, testCase.Target); err != testCase.Expectation {
+			t.Errorf("Unmarshal() returned '%v' instead of '%v' for %v", err, testCase.Expectation, testCase.Data)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	in := wallet{Owner: "alice", Balance: &money{250, "EUR"}, Limit: -3}
+
+	data, err := Marshal(in)
+	if err != nil {
+		t.Fatalf("Marshal() returned an error: %v", err)
+	}
+
+	var out wallet
+	if err = Unmarshal(data, &out); err != nil {
+		t.Fatalf("Unmarshal() returned an error: %v", err)
+	}
+
+	if out.Owner != in.Owner || out.Limit != in.Limit || *out.Balance != *in.Balance {
+		t.Errorf("round trip returned %#v instead of %#v", out, in)
+	}
+}
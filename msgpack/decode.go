@@ -0,0 +1,530 @@
+package msgpack
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"math/big"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/adjust/gorails/marshal"
+)
+
+// Decode returns the value of a message written by the Rails serializer.
+//
+// Strings are decoded as string and binary strings as []byte. Integers are
+// int64, or *big.Int if they do not fit. Floats are float64, arrays
+// []interface{} and hashes marshal.Hash, keeping the order and the types of
+// their keys. HashWithIndifferentAccess is a marshal.Hash as well.
+//
+// Symbols are decoded as marshal.Symbol, BigDecimals as marshal.UserDefined
+// holding their _dump, Rationals as *big.Rat and Complex numbers as
+// complex128. Time, DateTime, Date and ActiveSupport::TimeWithZone are
+// time.Time, ActiveSupport::Duration is time.Duration. URIs are *url.URL,
+// IPAddrs net.IP and Pathnames string. Ranges, Sets and TimeZones are
+// decoded as the types of this package.
+func Decode(data []byte) (interface{}, error) {
+	if !bytes.HasPrefix(data, signature) {
+		return nil, ErrUnknownFormat
+	}
+
+	d := &decoder{data: data[len(signature):]}
+
+	return d.value()
+}
+
+type decoder struct {
+	data []byte
+	off  int
+}
+
+func (d *decoder) next(n int) ([]byte, error) {
+	if n < 0 || n > len(d.data)-d.off {
+		return nil, ErrMalformedData
+	}
+
+	b := d.data[d.off : d.off+n]
+	d.off += n
+
+	return b, nil
+}
+
+// uint reads a big-endian unsigned integer of n bytes.
+func (d *decoder) uint(n int) (uint64, error) {
+	b, err := d.next(n)
+	if err != nil {
+		return 0, err
+	}
+
+	var u uint64
+	for _, c := range b {
+		u = u<<8 | uint64(c)
+	}
+
+	return u, nil
+}
+
+// length reads a length of n bytes, which may not exceed the remaining data
+// as each element takes at least a byte.
+func (d *decoder) length(n int) (int, error) {
+	u, err := d.uint(n)
+	if err != nil {
+		return 0, err
+	}
+
+	if u > uint64(len(d.data)-d.off) {
+		return 0, ErrMalformedData
+	}
+
+	return int(u), nil
+}
+
+func (d *decoder) value() (interface{}, error) {
+	b, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+
+	switch c := b[0]; {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xf0 == 0x80:
+		return d.hash(int(c & 0x0f))
+	case c&0xf0 == 0x90:
+		return d.array(int(c & 0x0f))
+	case c&0xe0 == 0xa0:
+		return d.str(int(c & 0x1f))
+	}
+
+	switch b[0] {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.length(1 << (b[0] - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := d.next(n)
+		if err != nil {
+			return nil, err
+		}
+
+		return append([]byte(nil), data...), nil
+	case 0xc7, 0xc8, 0xc9:
+		n, err := d.length(1 << (b[0] - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+
+		return d.ext(n)
+	case 0xca:
+		u, err := d.uint(4)
+		return float64(math.Float32frombits(uint32(u))), err
+	case 0xcb:
+		u, err := d.uint(8)
+		return math.Float64frombits(u), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		u, err := d.uint(1 << (b[0] - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+
+		if u > math.MaxInt64 {
+			return new(big.Int).SetUint64(u), nil
+		}
+
+		return int64(u), nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (b[0] - 0xd0)
+
+		u, err := d.uint(size)
+		if err != nil {
+			return nil, err
+		}
+
+		// sign extend
+		shift := uint(64 - 8*size)
+		return int64(u<<shift) >> shift, nil
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return d.ext(1 << (b[0] - 0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.length(1 << (b[0] - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+
+		return d.str(n)
+	case 0xdc, 0xdd:
+		n, err := d.length(2 << (b[0] - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+
+		return d.array(n)
+	case 0xde, 0xdf:
+		n, err := d.length(2 << (b[0] - 0xde))
+		if err != nil {
+			return nil, err
+		}
+
+		return d.hash(n)
+	}
+
+	return nil, ErrMalformedData
+}
+
+func (d *decoder) str(n int) (interface{}, error) {
+	data, err := d.next(n)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(data), nil
+}
+
+func (d *decoder) array(n int) ([]interface{}, error) {
+	array := make([]interface{}, n)
+	for i := range array {
+		var err error
+		if array[i], err = d.value(); err != nil {
+			return nil, err
+		}
+	}
+
+	return array, nil
+}
+
+func (d *decoder) hash(n int) (marshal.Hash, error) {
+	hash := make(marshal.Hash, n)
+	for i := range hash {
+		var err error
+		if hash[i].Key, err = d.value(); err != nil {
+			return nil, err
+		}
+		if hash[i].Value, err = d.value(); err != nil {
+			return nil, err
+		}
+	}
+
+	return hash, nil
+}
+
+// ext reads an extension value with a payload of n bytes. Types Rails
+// registers as recursive hold a sequence of values in their payload.
+func (d *decoder) ext(n int) (interface{}, error) {
+	b, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	typ := int8(b[0])
+
+	data, err := d.next(n)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := &decoder{data: data}
+
+	switch typ {
+	case extSymbol:
+		return marshal.Symbol(data), nil
+	case extBigint:
+		return bigint(data)
+	case extBigDecimal:
+		return marshal.UserDefined{Class: "BigDecimal", Data: append([]byte(nil), data...)}, nil
+	case extRational:
+		return payload.rational()
+	case extComplex:
+		re, err := payload.float()
+		if err != nil {
+			return nil, err
+		}
+		im, err := payload.float()
+		if err != nil {
+			return nil, err
+		}
+
+		return complex(re, im), nil
+	case extDateTime:
+		return payload.dateTime()
+	case extDate:
+		jd, err := payload.integer()
+		if err != nil {
+			return nil, err
+		}
+
+		return julianDay(jd, time.UTC), nil
+	case extTime:
+		return payload.time()
+	case extTimeWithZone:
+		t, err := payload.time()
+		if err != nil {
+			return nil, err
+		}
+
+		zone, err := payload.value()
+		if err != nil {
+			return nil, err
+		}
+
+		var name string
+		switch z := zone.(type) {
+		case string:
+			name = z
+		case TimeZone:
+			name = string(z)
+		default:
+			return nil, ErrMalformedData
+		}
+
+		_, offset := t.Zone()
+		if loc, err := time.LoadLocation(name); err == nil {
+			return t.In(loc), nil
+		}
+
+		return t.In(time.FixedZone(name, offset)), nil
+	case extTimeZone:
+		return TimeZone(data), nil
+	case extDuration:
+		seconds, err := payload.float()
+		if err != nil {
+			return nil, err
+		}
+
+		// The parts of the duration, e.g. [nil, 1, nil, ...] for 1 month,
+		// follow the value in seconds.
+		if _, err := payload.value(); err != nil {
+			return nil, err
+		}
+
+		return time.Duration(seconds * float64(time.Second)), nil
+	case extRange:
+		values, err := payload.array(3)
+		if err != nil {
+			return nil, err
+		}
+
+		exclusive, ok := values[2].(bool)
+		if !ok {
+			return nil, ErrMalformedData
+		}
+
+		return Range{Begin: values[0], End: values[1], Exclusive: exclusive}, nil
+	case extSet:
+		elements, err := payload.value()
+		if err != nil {
+			return nil, err
+		}
+
+		array, ok := elements.([]interface{})
+		if !ok {
+			return nil, ErrMalformedData
+		}
+
+		return Set(array), nil
+	case extURI:
+		u, err := url.Parse(string(data))
+		if err != nil {
+			return nil, ErrMalformedData
+		}
+
+		return u, nil
+	case extIPAddr:
+		ip := net.ParseIP(string(data))
+		if ip == nil {
+			return nil, ErrMalformedData
+		}
+
+		return ip, nil
+	case extPathname:
+		return string(data), nil
+	case extHWIA:
+		hash, err := payload.value()
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := hash.(marshal.Hash); !ok {
+			return nil, ErrMalformedData
+		}
+
+		return hash, nil
+	case extObject:
+		values, err := payload.array(3)
+		if err != nil {
+			return nil, err
+		}
+
+		// values[0] tells whether the class is loaded with from_msgpack_ext
+		// or json_create.
+		class, ok := values[1].(string)
+		if !ok {
+			return nil, ErrMalformedData
+		}
+
+		return Object{Class: class, Data: values[2]}, nil
+	}
+
+	return Ext{Type: typ, Data: append([]byte(nil), data...)}, nil
+}
+
+// bigint decodes MessagePack::Bigint: a sign byte followed by 32-bit
+// big-endian chunks of the magnitude, least significant chunk first.
+func bigint(data []byte) (*big.Int, error) {
+	if len(data) == 0 || (len(data)-1)%4 != 0 {
+		return nil, ErrMalformedData
+	}
+
+	i := new(big.Int)
+	for off := len(data) - 4; off >= 1; off -= 4 {
+		i.Lsh(i, 32)
+		i.Or(i, new(big.Int).SetUint64(uint64(binary.BigEndian.Uint32(data[off:]))))
+	}
+
+	if data[0] != 0 {
+		i.Neg(i)
+	}
+
+	return i, nil
+}
+
+func (d *decoder) integer() (int64, error) {
+	v, err := d.value()
+	if err != nil {
+		return 0, err
+	}
+
+	i, ok := v.(int64)
+	if !ok {
+		return 0, ErrMalformedData
+	}
+
+	return i, nil
+}
+
+func (d *decoder) bigInteger() (*big.Int, error) {
+	v, err := d.value()
+	if err != nil {
+		return nil, err
+	}
+
+	switch i := v.(type) {
+	case int64:
+		return big.NewInt(i), nil
+	case *big.Int:
+		return i, nil
+	}
+
+	return nil, ErrMalformedData
+}
+
+func (d *decoder) float() (float64, error) {
+	v, err := d.value()
+	if err != nil {
+		return 0, err
+	}
+
+	switch x := v.(type) {
+	case int64:
+		return float64(x), nil
+	case float64:
+		return x, nil
+	case *big.Int:
+		f, _ := new(big.Float).SetInt(x).Float64()
+		return f, nil
+	case *big.Rat:
+		f, _ := x.Float64()
+		return f, nil
+	}
+
+	return 0, ErrMalformedData
+}
+
+// rational reads a numerator, followed by a denominator unless the
+// numerator is zero.
+func (d *decoder) rational() (*big.Rat, error) {
+	num, err := d.bigInteger()
+	if err != nil {
+		return nil, err
+	}
+
+	if num.Sign() == 0 {
+		return new(big.Rat), nil
+	}
+
+	denom, err := d.bigInteger()
+	if err != nil {
+		return nil, err
+	}
+	if denom.Sign() == 0 {
+		return nil, ErrMalformedData
+	}
+
+	return new(big.Rat).SetFrac(num, denom), nil
+}
+
+// time reads seconds and nanoseconds since the epoch and the UTC offset.
+func (d *decoder) time() (time.Time, error) {
+	var values [3]int64
+	for i := range values {
+		var err error
+		if values[i], err = d.integer(); err != nil {
+			return time.Time{}, err
+		}
+	}
+
+	return time.Unix(values[0], values[1]).In(zone(values[2])), nil
+}
+
+// dateTime reads the Julian day, hour, minute and second in local time, the
+// fraction of the second and the UTC offset as a fraction of a day.
+func (d *decoder) dateTime() (time.Time, error) {
+	var values [4]int64
+	for i := range values {
+		var err error
+		if values[i], err = d.integer(); err != nil {
+			return time.Time{}, err
+		}
+	}
+
+	fraction, err := d.rational()
+	if err != nil {
+		return time.Time{}, err
+	}
+	offset, err := d.rational()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	nsec, _ := new(big.Rat).Mul(fraction, big.NewRat(int64(time.Second), 1)).Float64()
+	seconds, _ := new(big.Rat).Mul(offset, big.NewRat(86400, 1)).Float64()
+
+	day := julianDay(values[0], zone(int64(seconds)))
+	y, m, dd := day.Date()
+
+	return time.Date(y, m, dd, int(values[1]), int(values[2]), int(values[3]), int(nsec), day.Location()), nil
+}
+
+// Julian day 2440588 is 1970-01-01.
+func julianDay(jd int64, loc *time.Location) time.Time {
+	y, m, d := time.Unix((jd-2440588)*86400, 0).UTC().Date()
+
+	return time.Date(y, m, d, 0, 0, 0, 0, loc)
+}
+
+func zone(offset int64) *time.Location {
+	if offset == 0 {
+		return time.UTC
+	}
+
+	return time.FixedZone("", int(offset))
+}
@@ -0,0 +1,91 @@
+package msgpack
+
+import (
+	"fmt"
+	"testing"
+)
+
+type decodeTestCase struct {
+	Data        []byte
+	Expectation string // type and value of the result
+}
+
+func TestDecode(t *testing.T) {
+	tests := []decodeTestCase{
+		{[]byte{0xcc, 0x80, 0xc0}, "<nil> <nil>"},
+		{[]byte{0xcc, 0x80, 0xc3}, "bool true"},
+		{[]byte{0xcc, 0x80, 0x2a}, "int64 42"},
+		{[]byte{0xcc, 0x80, 0xff}, "int64 -1"},
+		{[]byte{0xcc, 0x80, 0xd1, 0xfc, 0x18}, "int64 -1000"},
+		{[]byte{0xcc, 0x80, 0xcf, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, "*big.Int 18446744073709551615"},
+		{[]byte{0xcc, 0x80, 0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}, "float64 1.5"},
+		{[]byte{0xcc, 0x80, 0xa3, 'f', 'o', 'o'}, "string foo"},
+		{[]byte{0xcc, 0x80, 0xc4, 0x02, 0x00, 0xff}, "[]uint8 [0 255]"},
+		{[]byte{0xcc, 0x80, 0x92, 0x01, 0xa1, 'a'}, "[]interface {} [1 a]"},
+		{[]byte{0xcc, 0x80, 0x82, 0xa1, 'a', 0x01, 0xd4, 0x00, 'b', 0xc2}, "marshal.Hash [{a 1} {b false}]"},
+		// :foo
+		{[]byte{0xcc, 0x80, 0xc7, 0x03, 0x00, 'f', 'o', 'o'}, "marshal.Symbol foo"},
+		// 2**64
+		{[]byte{0xcc, 0x80, 0xc7, 0x0d, 0x01, 0x00, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}, "*big.Int 18446744073709551616"},
+		// BigDecimal("1")
+		{append([]byte{0xcc, 0x80, 0xd7, 0x02}, "18:0.1e1"...), "marshal.UserDefined {BigDecimal [49 56 58 48 46 49 101 49]}"},
+		// Rational(1, 3)
+		{[]byte{0xcc, 0x80, 0xd5, 0x03, 0x01, 0x03}, "*big.Rat 1/3"},
+		// Complex(1, 2)
+		{[]byte{0xcc, 0x80, 0xd5, 0x04, 0x01, 0x02}, "complex128 (1+2i)"},
+		// DateTime.new(2024, 1, 1, 12, 30, 15.5, "+01:00")
+		{[]byte{0xcc, 0x80, 0xc7, 0x0c, 0x05, 0xce, 0x00, 0x25, 0x8a, 0x97, 0x0c, 0x1e, 0x0f, 0x01, 0x02, 0x01, 0x18}, "time.Time 2024-01-01 12:30:15.5 +0100 +0100"},
+		// Date.new(2024, 1, 1)
+		{[]byte{0xcc, 0x80, 0xc7, 0x05, 0x06, 0xce, 0x00, 0x25, 0x8a, 0x97}, "time.Time 2024-01-01 00:00:00 +0000 UTC"},
+		// Time.at(1700000000, 5, :nsec, in: "+01:00")
+		{[]byte{0xcc, 0x80, 0xc7, 0x09, 0x07, 0xce, 0x65, 0x53, 0xf1, 0x00, 0x05, 0xcd, 0x0e, 0x10}, "time.Time 2023-11-14 23:13:20.000000005 +0100 +0100"},
+		// Time.at(1700000000).in_time_zone("UTC")
+		{[]byte{0xcc, 0x80, 0xc7, 0x0b, 0x08, 0xce, 0x65, 0x53, 0xf1, 0x00, 0x00, 0x00, 0xa3, 'U', 'T', 'C'}, "time.Time 2023-11-14 22:13:20 +0000 UTC"},
+		// 1.month
+		{[]byte{0xcc, 0x80, 0xc7, 0x0d, 0x0a, 0xce, 0x00, 0x28, 0x20, 0x72, 0x97, 0xc0, 0x01, 0xc0, 0xc0, 0xc0, 0xc0, 0xc0}, "time.Duration 730h29m6s"},
+		// 1...3
+		{[]byte{0xcc, 0x80, 0xc7, 0x03, 0x0b, 0x01, 0x03, 0xc3}, "msgpack.Range {1 3 true}"},
+		// Set[1, 2]
+		{[]byte{0xcc, 0x80, 0xc7, 0x03, 0x0c, 0x92, 0x01, 0x02}, "msgpack.Set [1 2]"},
+		{append([]byte{0xcc, 0x80, 0xc7, 0x13, 0x0d}, "https://example.com"...), "*url.URL https://example.com"},
+		{append([]byte{0xcc, 0x80, 0xc7, 0x09, 0x0e}, "127.0.0.1"...), "net.IP 127.0.0.1"},
+		// ActiveSupport::HashWithIndifferentAccess
+		{[]byte{0xcc, 0x80, 0xd6, 0x11, 0x81, 0xa1, 'a', 0x01}, "marshal.Hash [{a 1}]"},
+		{[]byte{0xcc, 0x80, 0xd4, 0x63, 0x01}, "msgpack.Ext {99 [1]}"},
+	}
+
+	for _, testCase := range tests {
+		v, err := Decode(testCase.Data)
+		if err != nil {
+			t.Errorf("Decode(% x) returned an error: %v", testCase.Data, err)
+			continue
+		}
+
+		if s := fmt.Sprintf("%T %v", v, v); s != testCase.Expectation {
+			t.Errorf("Decode(% x) returned %s instead of %s", testCase.Data, s, testCase.Expectation)
+		}
+	}
+}
+
+type decodeErrorTestCase struct {
+	Data []byte
+	Err  error
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []decodeErrorTestCase{
+		{[]byte{}, ErrUnknownFormat},
+		{[]byte{0x04, 0x08, 0x30}, ErrUnknownFormat},
+		{[]byte{0xcc, 0x80}, ErrMalformedData},
+		{[]byte{0xcc, 0x80, 0xc1}, ErrMalformedData},
+		{[]byte{0xcc, 0x80, 0xa3, 'f'}, ErrMalformedData},
+		{[]byte{0xcc, 0x80, 0xdd, 0xff, 0xff, 0xff, 0xff}, ErrMalformedData},
+		{[]byte{0xcc, 0x80, 0xd4, 0x0b, 0x01}, ErrMalformedData},
+	}
+
+	for _, testCase := range tests {
+		if _, err := Decode(testCase.Data); err != testCase.Err {
+			t.Errorf("Decode(% x) returned %v instead of %v", testCase.Data, err, testCase.Err)
+		}
+	}
+}
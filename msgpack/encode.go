@@ -0,0 +1,317 @@
+package msgpack
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"net/url"
+	"reflect"
+	"sort"
+	"time"
+	"unicode/utf8"
+
+	"github.com/adjust/gorails/marshal"
+)
+
+// Encode returns the message the Rails serializer would write for v.
+//
+// Encode uses the inverse of the mapping used by Decode. Besides, booleans,
+// integers, floats and strings of any Go type are supported, as are slices,
+// arrays and maps. Map keys are sorted by their string representation.
+// Strings that are not valid UTF-8 are encoded as binary strings, like
+// []byte. A time.Time is encoded as a Ruby Time with its UTC offset.
+func Encode(v interface{}) ([]byte, error) {
+	e := &encodeState{}
+	e.Write(signature)
+
+	if err := e.encode(reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+
+	return e.Bytes(), nil
+}
+
+type encodeState struct {
+	bytes.Buffer
+}
+
+func (e *encodeState) encode(v reflect.Value) error {
+	if !v.IsValid() {
+		e.WriteByte(0xc0)
+		return nil
+	}
+
+	switch x := v.Interface().(type) {
+	case marshal.Symbol:
+		e.writeExt(extSymbol, []byte(x))
+		return nil
+	case marshal.Hash:
+		e.writeHeader(0x80, 16, 0, 0xde, 0xdf, len(x))
+		for _, p := range x {
+			if err := e.encode(reflect.ValueOf(p.Key)); err != nil {
+				return err
+			}
+			if err := e.encode(reflect.ValueOf(p.Value)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case marshal.UserDefined:
+		if x.Class != "BigDecimal" {
+			return ErrUnsupportedValue
+		}
+		e.writeExt(extBigDecimal, x.Data)
+		return nil
+	case *big.Int:
+		if x == nil {
+			break
+		}
+		if x.IsInt64() {
+			e.writeInt(x.Int64())
+			return nil
+		}
+		e.writeExt(extBigint, bigintBytes(x))
+		return nil
+	case *big.Rat:
+		if x == nil {
+			break
+		}
+		return e.writeRecursive(extRational, x.Num(), x.Denom())
+	case time.Time:
+		_, offset := x.Zone()
+		return e.writeRecursive(extTime, x.Unix(), x.Nanosecond(), offset)
+	case time.Duration:
+		seconds := x.Seconds()
+		if x%time.Second == 0 {
+			return e.writeRecursive(extDuration, int64(seconds), []interface{}{nil, nil, nil, nil, nil, nil, int64(seconds)})
+		}
+		return e.writeRecursive(extDuration, seconds, []interface{}{nil, nil, nil, nil, nil, nil, seconds})
+	case TimeZone:
+		e.writeExt(extTimeZone, []byte(x))
+		return nil
+	case Range:
+		return e.writeRecursive(extRange, x.Begin, x.End, x.Exclusive)
+	case Set:
+		return e.writeRecursive(extSet, []interface{}(x))
+	case *url.URL:
+		if x == nil {
+			break
+		}
+		e.writeExt(extURI, []byte(x.String()))
+		return nil
+	case net.IP:
+		if x == nil {
+			break
+		}
+		e.writeExt(extIPAddr, []byte(x.String()))
+		return nil
+	case Object:
+		// loaded with from_msgpack_ext
+		return e.writeRecursive(extObject, 0, x.Class, x.Data)
+	case Ext:
+		e.writeExt(x.Type, x.Data)
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			e.WriteByte(0xc3)
+		} else {
+			e.WriteByte(0xc2)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.writeInt(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.writeUint(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		e.WriteByte(0xcb)
+		binary.Write(e, binary.BigEndian, math.Float64bits(v.Float()))
+	case reflect.Complex64, reflect.Complex128:
+		c := v.Complex()
+		return e.writeRecursive(extComplex, real(c), imag(c))
+	case reflect.String:
+		if utf8.ValidString(v.String()) {
+			e.writeHeader(0xa0, 32, 0xd9, 0xda, 0xdb, len(v.String()))
+		} else {
+			e.writeHeader(0, 0, 0xc4, 0xc5, 0xc6, len(v.String()))
+		}
+		e.WriteString(v.String())
+	case reflect.Slice:
+		if v.IsNil() {
+			e.WriteByte(0xc0)
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			e.writeHeader(0, 0, 0xc4, 0xc5, 0xc6, v.Len())
+			e.Write(v.Bytes())
+			return nil
+		}
+		fallthrough
+	case reflect.Array:
+		e.writeHeader(0x90, 16, 0, 0xdc, 0xdd, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			if err := e.encode(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			e.WriteByte(0xc0)
+			return nil
+		}
+
+		keys := v.MapKeys()
+		sort.Sort(byString(keys))
+
+		e.writeHeader(0x80, 16, 0, 0xde, 0xdf, len(keys))
+		for _, k := range keys {
+			if err := e.encode(k); err != nil {
+				return err
+			}
+			if err := e.encode(v.MapIndex(k)); err != nil {
+				return err
+			}
+		}
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			e.WriteByte(0xc0)
+			return nil
+		}
+		return e.encode(v.Elem())
+	default:
+		return ErrUnsupportedValue
+	}
+
+	return nil
+}
+
+func (e *encodeState) writeInt(i int64) {
+	switch {
+	case i >= 0:
+		e.writeUint(uint64(i))
+	case i >= -32:
+		e.WriteByte(byte(i))
+	case i >= math.MinInt8:
+		e.WriteByte(0xd0)
+		e.WriteByte(byte(i))
+	case i >= math.MinInt16:
+		e.WriteByte(0xd1)
+		binary.Write(e, binary.BigEndian, int16(i))
+	case i >= math.MinInt32:
+		e.WriteByte(0xd2)
+		binary.Write(e, binary.BigEndian, int32(i))
+	default:
+		e.WriteByte(0xd3)
+		binary.Write(e, binary.BigEndian, i)
+	}
+}
+
+func (e *encodeState) writeUint(u uint64) {
+	switch {
+	case u <= 0x7f:
+		e.WriteByte(byte(u))
+	case u <= math.MaxUint8:
+		e.WriteByte(0xcc)
+		e.WriteByte(byte(u))
+	case u <= math.MaxUint16:
+		e.WriteByte(0xcd)
+		binary.Write(e, binary.BigEndian, uint16(u))
+	case u <= math.MaxUint32:
+		e.WriteByte(0xce)
+		binary.Write(e, binary.BigEndian, uint32(u))
+	default:
+		e.WriteByte(0xcf)
+		binary.Write(e, binary.BigEndian, u)
+	}
+}
+
+// writeHeader writes the type and length of a string, binary string, array
+// or map, e.g. writeHeader(0xa0, 32, 0xd9, 0xda, 0xdb, n) for a string. The
+// fix type holds lengths up to fixLimit, short is 0 if there is no type with
+// an 8-bit length.
+func (e *encodeState) writeHeader(fix byte, fixLimit int, short, medium, long byte, n int) {
+	switch {
+	case n < fixLimit:
+		e.WriteByte(fix | byte(n))
+	case short != 0 && n <= math.MaxUint8:
+		e.WriteByte(short)
+		e.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		e.WriteByte(medium)
+		binary.Write(e, binary.BigEndian, uint16(n))
+	default:
+		e.WriteByte(long)
+		binary.Write(e, binary.BigEndian, uint32(n))
+	}
+}
+
+func (e *encodeState) writeExt(typ int8, data []byte) {
+	switch len(data) {
+	case 1:
+		e.WriteByte(0xd4)
+	case 2:
+		e.WriteByte(0xd5)
+	case 4:
+		e.WriteByte(0xd6)
+	case 8:
+		e.WriteByte(0xd7)
+	case 16:
+		e.WriteByte(0xd8)
+	default:
+		switch {
+		case len(data) <= math.MaxUint8:
+			e.WriteByte(0xc7)
+			e.WriteByte(byte(len(data)))
+		case len(data) <= math.MaxUint16:
+			e.WriteByte(0xc8)
+			binary.Write(e, binary.BigEndian, uint16(len(data)))
+		default:
+			e.WriteByte(0xc9)
+			binary.Write(e, binary.BigEndian, uint32(len(data)))
+		}
+	}
+
+	e.WriteByte(byte(typ))
+	e.Write(data)
+}
+
+// writeRecursive writes an extension value whose payload is the encoding
+// of values.
+func (e *encodeState) writeRecursive(typ int8, values ...interface{}) error {
+	payload := &encodeState{}
+	for _, v := range values {
+		if err := payload.encode(reflect.ValueOf(v)); err != nil {
+			return err
+		}
+	}
+
+	e.writeExt(typ, payload.Bytes())
+
+	return nil
+}
+
+func bigintBytes(i *big.Int) []byte {
+	data := []byte{0}
+	if i.Sign() < 0 {
+		data[0] = 1
+	}
+
+	mask := big.NewInt(math.MaxUint32)
+	for u := new(big.Int).Abs(i); u.Sign() > 0; u.Rsh(u, 32) {
+		var chunk [4]byte
+		binary.BigEndian.PutUint32(chunk[:], uint32(new(big.Int).And(u, mask).Uint64()))
+		data = append(data, chunk[:]...)
+	}
+
+	return data
+}
+
+type byString []reflect.Value
+
+func (k byString) Len() int           { return len(k) }
+func (k byString) Swap(i, j int)      { k[i], k[j] = k[j], k[i] }
+func (k byString) Less(i, j int) bool { return fmt.Sprint(k[i]) < fmt.Sprint(k[j]) }
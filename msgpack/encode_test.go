@@ -0,0 +1,97 @@
+package msgpack
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adjust/gorails/marshal"
+)
+
+type encodeTestCase struct {
+	Value       interface{}
+	Expectation []byte // without the signature
+}
+
+func TestEncode(t *testing.T) {
+	tests := []encodeTestCase{
+		{nil, []byte{0xc0}},
+		{false, []byte{0xc2}},
+		{127, []byte{0x7f}},
+		{200, []byte{0xcc, 0xc8}},
+		{-32, []byte{0xe0}},
+		{-33, []byte{0xd0, 0xdf}},
+		{uint64(1 << 63), []byte{0xcf, 0x80, 0, 0, 0, 0, 0, 0, 0}},
+		{1.5, []byte{0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}},
+		{"foo", []byte{0xa3, 'f', 'o', 'o'}},
+		{strings.Repeat("a", 32), append([]byte{0xd9, 0x20}, strings.Repeat("a", 32)...)},
+		{"\xff", []byte{0xc4, 0x01, 0xff}},
+		{[]byte{1}, []byte{0xc4, 0x01, 0x01}},
+		{[]int{1, 2}, []byte{0x92, 0x01, 0x02}},
+		{map[string]int{"b": 2, "a": 1}, []byte{0x82, 0xa1, 'a', 0x01, 0xa1, 'b', 0x02}},
+		{marshal.Hash{{Key: marshal.Symbol("id"), Value: 1}}, []byte{0x81, 0xd5, 0x00, 'i', 'd', 0x01}},
+		{marshal.Symbol("foo"), []byte{0xc7, 0x03, 0x00, 'f', 'o', 'o'}},
+		{new(big.Int).Lsh(big.NewInt(1), 64), []byte{0xc7, 0x0d, 0x01, 0x00, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}},
+		{big.NewRat(1, 3), []byte{0xd5, 0x03, 0x01, 0x03}},
+		{time.Unix(1700000000, 5).In(time.FixedZone("", 3600)), []byte{0xc7, 0x09, 0x07, 0xce, 0x65, 0x53, 0xf1, 0x00, 0x05, 0xcd, 0x0e, 0x10}},
+		{Range{1, 3, true}, []byte{0xc7, 0x03, 0x0b, 0x01, 0x03, 0xc3}},
+		{Set{1, 2}, []byte{0xc7, 0x03, 0x0c, 0x92, 0x01, 0x02}},
+	}
+
+	for _, testCase := range tests {
+		data, err := Encode(testCase.Value)
+		if err != nil {
+			t.Errorf("Encode(%v) returned an error: %v", testCase.Value, err)
+			continue
+		}
+
+		if expectation := append([]byte{0xcc, 0x80}, testCase.Expectation...); !bytes.Equal(data, expectation) {
+			t.Errorf("Encode(%v) returned % x instead of % x", testCase.Value, data, expectation)
+		}
+	}
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	values := []interface{}{
+		int64(-1 << 40),
+		new(big.Int).Neg(new(big.Int).Lsh(big.NewInt(3), 100)),
+		strings.Repeat("x", 70000),
+		complex(1.5, -2),
+		90 * time.Minute,
+		TimeZone("Berlin"),
+		net.ParseIP("::1"),
+		marshal.UserDefined{Class: "BigDecimal", Data: []byte("18:0.1e1")},
+		Object{Class: "Money", Data: []interface{}{int64(100), "EUR"}},
+		Ext{Type: 99, Data: []byte{1, 2, 3}},
+	}
+
+	for _, v := range values {
+		data, err := Encode(v)
+		if err != nil {
+			t.Errorf("Encode(%v) returned an error: %v", v, err)
+			continue
+		}
+
+		decoded, err := Decode(data)
+		if err != nil {
+			t.Errorf("Decode() returned an error for the output of Encode(%v): %v", v, err)
+			continue
+		}
+
+		if a, b := fmt.Sprintf("%T %v", v, v), fmt.Sprintf("%T %v", decoded, decoded); a != b {
+			t.Errorf("Decode(Encode(%s)) returned %s", a, b)
+		}
+	}
+}
+
+func TestEncodeUnsupported(t *testing.T) {
+	for _, v := range []interface{}{make(chan int), marshal.UserDefined{Class: "Foo"}} {
+		if _, err := Encode(v); err != ErrUnsupportedValue {
+			t.Errorf("Encode(%v) returned %v instead of ErrUnsupportedValue", v, err)
+		}
+	}
+}
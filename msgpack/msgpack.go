@@ -0,0 +1,66 @@
+// Package msgpack reads and writes the output of the :message_pack serializer
+// added in Rails 7.1 for cookies, message verifiers and encryptors. It is a
+// MessagePack implementation supporting the extension types Rails registers
+// for Ruby values such as symbols, times and big decimals.
+package msgpack
+
+import (
+	"errors"
+)
+
+var (
+	ErrUnknownFormat    = errors.New("msgpack: missing serializer signature")
+	ErrMalformedData    = errors.New("msgpack: malformed data")
+	ErrUnsupportedValue = errors.New("msgpack: value can not be represented in MessagePack")
+)
+
+// Rails prefixes each message with 128 encoded as a MessagePack uint8.
+var signature = []byte{0xcc, 0x80}
+
+// Extension types registered by ActiveSupport::MessagePack.
+const (
+	extSymbol       = 0
+	extBigint       = 1
+	extBigDecimal   = 2
+	extRational     = 3
+	extComplex      = 4
+	extDateTime     = 5
+	extDate         = 6
+	extTime         = 7
+	extTimeWithZone = 8
+	extTimeZone     = 9
+	extDuration     = 10
+	extRange        = 11
+	extSet          = 12
+	extURI          = 13
+	extIPAddr       = 14
+	extPathname     = 15
+	extHWIA         = 17
+	extObject       = 127
+)
+
+// Range is a Ruby Range.
+type Range struct {
+	Begin, End interface{}
+	Exclusive  bool
+}
+
+// Set is a Ruby Set.
+type Set []interface{}
+
+// TimeZone is an ActiveSupport::TimeZone, identified by its name, e.g.
+// "Eastern Time (US & Canada)".
+type TimeZone string
+
+// Object is an instance of a class that is serialized with its own
+// to_msgpack_ext or as_json method, which returned Data.
+type Object struct {
+	Class string
+	Data  interface{}
+}
+
+// Ext is a value of an extension type this package does not know.
+type Ext struct {
+	Type int8
+	Data []byte
+}
@@ -0,0 +1,67 @@
+package session
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+type generateKeyTestCase struct {
+	Config      Config
+	Expectation string
+}
+
+func TestConfigGenerateKey(t *testing.T) {
+	tests := []generateKeyTestCase{
+		{Rails40, "dcc8261c587fbf202070a0f4b9f32154806d5fea5091dd17210c04dffd401df10e23417b213aab4bcf5344c2e7fe4a1d320e3e688d737f544068958b4e6a631a"},
+		{Rails52, "dcc8261c587fbf202070a0f4b9f32154806d5fea5091dd17210c04dffd401df10e23417b213aab4bcf5344c2e7fe4a1d320e3e688d737f544068958b4e6a631a"},
+		{Rails70, "d643ba3b75a9bcf7d990106a2e884c94892dc45458b598c25631fa09e39105fa2b4ef95ccc4ed3ebba5a25f2d2f22913068dadce6ae3e79f1ba721c6e5810bce"},
+	}
+
+	for _, testCase := range tests {
+		key := hex.EncodeToString(testCase.Config.GenerateKey(secretKeyBase, authenticatedSalt))
+		if key != testCase.Expectation {
+			t.Errorf("GenerateKey() returned %s instead of %s", key, testCase.Expectation)
+		}
+	}
+}
+
+func TestConfigDecryptCookie(t *testing.T) {
+	for _, cookie := range []string{signedCookie, authenticatedCookie} {
+		if _, err := Rails40.DecryptCookie(cookie, secretKeyBase); err != nil {
+			t.Errorf("Rails40.DecryptCookie(%q) returned error %v", cookie, err)
+		}
+	}
+
+	if _, err := Rails70.DecryptCookie(authenticatedCookie, secretKeyBase); err != ErrInvalidSignature {
+		t.Errorf("Rails70.DecryptCookie() of a Rails 5.2 cookie returned error %v instead of %v", err, ErrInvalidSignature)
+	}
+}
+
+func TestConfigEncryptCookie(t *testing.T) {
+	data := []byte(`{"session_id":"2d1d2bd9d37c5b6b1c9b5a2fb1ea6c52"}`)
+
+	for _, config := range []Config{Rails40, Rails52, Rails61, Rails70} {
+		cookie, err := config.EncryptCookie(data, secretKeyBase)
+		if err != nil {
+			t.Errorf("EncryptCookie() with cipher %s returned error %v", config.Cipher, err)
+			continue
+		}
+
+		decrypted, err := config.DecryptCookie(cookie, secretKeyBase)
+		if err != nil {
+			t.Errorf("DecryptCookie(EncryptCookie()) with cipher %s returned error %v", config.Cipher, err)
+			continue
+		}
+
+		if !bytes.Equal(decrypted, data) {
+			t.Errorf("DecryptCookie(EncryptCookie()) with cipher %s returned %q", config.Cipher, decrypted)
+		}
+	}
+
+	config := Rails70
+	config.Cipher = "aes-128-ecb"
+	if _, err := config.EncryptCookie(data, secretKeyBase); err != ErrUnsupportedCipher {
+		t.Errorf("EncryptCookie() with cipher %s returned error %v instead of %v", config.Cipher, err, ErrUnsupportedCipher)
+	}
+}
@@ -0,0 +1,154 @@
+package session
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"hash"
+	"time"
+
+	"github.com/adjust/gorails/marshal"
+	"github.com/adjust/gorails/msgpack"
+)
+
+var ErrInvalidKey = errors.New("session: key must be at least 32 bytes long")
+
+// Serializer converts a value into the format of a Rails serializer.
+type Serializer func(v interface{}) ([]byte, error)
+
+var (
+	JSONSerializer        Serializer = json.Marshal
+	MarshalSerializer     Serializer = marshal.Marshal
+	MessagePackSerializer Serializer = msgpack.Encode
+)
+
+// NullSerializer passes through values that are serialized already, which
+// must be []byte or string.
+func NullSerializer(v interface{}) ([]byte, error) {
+	switch x := v.(type) {
+	case []byte:
+		return x, nil
+	case string:
+		return []byte(x), nil
+	}
+
+	return nil, ErrKindMismatch
+}
+
+// MessageEncryptor reads and writes messages encrypted by
+// ActiveSupport::MessageEncryptor, which Rails uses for encrypted cookies,
+// Active Storage and Action Text, so that encrypted tokens can be exchanged
+// with Rails code:
+//
+//	secret := session.Rails70.GenerateKey(secretKeyBase, "my tokens")
+//	encryptor := session.MessageEncryptor{Secret: secret, Cipher: session.AES256GCM}
+//
+//	token, err := encryptor.Encrypt(map[string]interface{}{"user_id": 1}, "login", time.Now().Add(time.Hour))
+type MessageEncryptor struct {
+	// Secret is the encryption key, of which the first 32 bytes are used.
+	Secret []byte
+	// SignSecret is the HMAC key of AES256CBC messages, Secret if nil.
+	SignSecret []byte
+	// Cipher is AES256CBC or AES256GCM.
+	Cipher string
+	// Digest is the HMAC digest of AES256CBC messages, sha1.New if nil.
+	Digest func() hash.Hash
+	// Serializer serializes the values passed to Encrypt,
+	// JSONSerializer if nil. Decrypt detects the serializer of a message.
+	Serializer Serializer
+}
+
+// Encrypt returns value serialized and encrypted, with purpose and expiresAt
+// as metadata unless they are empty. A zero expiresAt never expires.
+func (e MessageEncryptor) Encrypt(value interface{}, purpose string, expiresAt time.Time) (string, error) {
+	if len(e.Secret) < 32 {
+		return "", ErrInvalidKey
+	}
+
+	serializer := e.Serializer
+	if serializer == nil {
+		serializer = JSONSerializer
+	}
+
+	data, err := serializer(value)
+	if err != nil {
+		return "", err
+	}
+
+	if purpose != "" || !expiresAt.IsZero() {
+		data = WrapMessage(data, purpose, expiresAt)
+	}
+
+	switch e.Cipher {
+	case AES256CBC:
+		return encryptAndSignMessage(data, e.Secret, e.signSecret(), e.digest())
+	case AES256GCM:
+		return encryptAuthenticatedMessage(data, e.Secret)
+	}
+
+	return "", ErrUnsupportedCipher
+}
+
+// Decrypt returns the Value of an encrypted message, verifying its purpose
+// and expiry time like DecodeMessage.
+func (e MessageEncryptor) Decrypt(token, purpose string) (Value, error) {
+	data, err := e.DecryptData(token)
+	if err != nil {
+		return nil, err
+	}
+
+	return DecodeMessage(data, purpose)
+}
+
+// DecryptData returns the decrypted data of a message as it is, including
+// its serialization and metadata.
+func (e MessageEncryptor) DecryptData(token string) ([]byte, error) {
+	if len(e.Secret) < 32 {
+		return nil, ErrInvalidKey
+	}
+
+	switch e.Cipher {
+	case AES256CBC:
+		return decryptSignedMessage(token, e.Secret, e.signSecret(), e.digest())
+	case AES256GCM:
+		return decryptAuthenticatedMessage(token, e.Secret)
+	}
+
+	return nil, ErrUnsupportedCipher
+}
+
+func (e MessageEncryptor) signSecret() []byte {
+	if e.SignSecret == nil {
+		return e.Secret
+	}
+
+	return e.SignSecret
+}
+
+func (e MessageEncryptor) digest() func() hash.Hash {
+	if e.Digest == nil {
+		return sha1.New
+	}
+
+	return e.Digest
+}
+
+// CookieEncryptor returns the MessageEncryptor of cookies.encrypted, which
+// encrypts cookies serialized by the cookie jar already.
+func (c Config) CookieEncryptor(secretKeyBase string) MessageEncryptor {
+	if c.Cipher == AES256GCM {
+		return MessageEncryptor{
+			Secret:     c.GenerateKey(secretKeyBase, c.AuthenticatedEncryptedCookieSalt),
+			Cipher:     AES256GCM,
+			Serializer: NullSerializer,
+		}
+	}
+
+	return MessageEncryptor{
+		Secret:     c.GenerateKey(secretKeyBase, c.EncryptedCookieSalt),
+		SignSecret: c.GenerateKey(secretKeyBase, c.EncryptedSignedCookieSalt),
+		Cipher:     c.Cipher,
+		Digest:     c.EncryptedSignedCookieDigest,
+		Serializer: NullSerializer,
+	}
+}
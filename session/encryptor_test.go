@@ -0,0 +1,100 @@
+package session
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestMessageEncryptor(t *testing.T) {
+	secret := Rails70.GenerateKey(secretKeyBase, "tokens")
+
+	for _, cipher := range []string{AES256CBC, AES256GCM} {
+		for _, serializer := range []Serializer{nil, JSONSerializer, MarshalSerializer, MessagePackSerializer} {
+			e := MessageEncryptor{Secret: secret, Cipher: cipher, Serializer: serializer}
+
+			token, err := e.Encrypt(map[string]interface{}{"user_id": 42}, "login", time.Now().Add(time.Hour))
+			if err != nil {
+				t.Errorf("Encrypt() with cipher %s returned error %v", cipher, err)
+				continue
+			}
+
+			v, err := e.Decrypt(token, "login")
+			if err != nil {
+				t.Errorf("Decrypt(Encrypt()) with cipher %s returned error %v", cipher, err)
+				continue
+			}
+
+			id, err := Lookup(v, "user_id")
+			if err != nil {
+				t.Errorf("Decrypt(Encrypt()) with cipher %s returned a value without user_id", cipher)
+				continue
+			}
+			if i, _ := id.Int(); i != 42 {
+				t.Errorf("Decrypt(Encrypt()) with cipher %s returned user_id %d instead of 42", cipher, i)
+			}
+
+			if _, err := e.Decrypt(token, "reset_password"); err != ErrPurposeMismatch {
+				t.Errorf("Decrypt() with a wrong purpose returned error %v instead of %v", err, ErrPurposeMismatch)
+			}
+		}
+
+		e := MessageEncryptor{Secret: secret, Cipher: cipher}
+
+		expired, _ := e.Encrypt(1, "", time.Now().Add(-time.Second))
+		if _, err := e.Decrypt(expired, ""); err != ErrExpired {
+			t.Errorf("Decrypt() of an expired message returned error %v instead of %v", err, ErrExpired)
+		}
+
+		plain, _ := e.Encrypt("hi", "", time.Time{})
+		if data, err := e.DecryptData(plain); err != nil || string(data) != `"hi"` {
+			t.Errorf("DecryptData() returned %q, %v instead of \"hi\"", data, err)
+		}
+	}
+}
+
+func TestMessageEncryptorErrors(t *testing.T) {
+	e := MessageEncryptor{Secret: []byte("short"), Cipher: AES256GCM}
+	if _, err := e.Encrypt(1, "", time.Time{}); err != ErrInvalidKey {
+		t.Errorf("Encrypt() with a short key returned error %v instead of %v", err, ErrInvalidKey)
+	}
+	if _, err := e.Decrypt("a--b--c", ""); err != ErrInvalidKey {
+		t.Errorf("Decrypt() with a short key returned error %v instead of %v", err, ErrInvalidKey)
+	}
+
+	e = MessageEncryptor{Secret: make([]byte, 32), Cipher: "aes-128-ecb"}
+	if _, err := e.Encrypt(1, "", time.Time{}); err != ErrUnsupportedCipher {
+		t.Errorf("Encrypt() with cipher %s returned error %v instead of %v", e.Cipher, err, ErrUnsupportedCipher)
+	}
+
+	e = MessageEncryptor{Secret: make([]byte, 32), Cipher: AES256GCM, Serializer: NullSerializer}
+	if _, err := e.Encrypt(1, "", time.Time{}); err != ErrKindMismatch {
+		t.Errorf("Encrypt() of an integer with NullSerializer returned error %v instead of %v", err, ErrKindMismatch)
+	}
+}
+
+type cookieEncryptorTestCase struct {
+	Config Config
+	Cookie string
+}
+
+func TestConfigCookieEncryptor(t *testing.T) {
+	tests := []cookieEncryptorTestCase{
+		{Rails40, signedCookie},
+		{Rails52, authenticatedCookie},
+	}
+
+	for _, testCase := range tests {
+		token, _ := url.QueryUnescape(testCase.Cookie)
+
+		v, err := testCase.Config.CookieEncryptor(secretKeyBase).Decrypt(token, "")
+		if err != nil {
+			t.Errorf("Decrypt(%q) returned error %v", token, err)
+			continue
+		}
+
+		if _, err := Lookup(v, "session_id"); err != nil {
+			t.Errorf("Decrypt(%q) returned a value without session_id", token)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+//go:build gofuzz
+// +build gofuzz
+
+package session
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// keys derived once, PBKDF2 would dominate the time of every run
+var (
+	fuzzSecretKeyBase = strings.Repeat("ab", 64)
+	fuzzSecret        = generateSecret(fuzzSecretKeyBase, DefaultEncryptedCookieSalt)
+	fuzzSignKey       = generateSecret(fuzzSecretKeyBase, DefaultEncryptedSignedCookieSalt)
+)
+
+// Fuzz is the go-fuzz entry point of DecryptSignedCookie. As arbitrary
+// cookies rarely pass signature verification, data is signed as well to
+// reach the decryption of malformed encrypted data.
+func Fuzz(data []byte) int {
+	if _, err := decryptSignedCookie(string(data), fuzzSecret, fuzzSignKey, sha1.New); err == nil {
+		return 1
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(data)
+	signed := encoded + "--" + hex.EncodeToString(generateSign(sha1.New, encoded, fuzzSignKey))
+	if _, err := decryptSignedMessage(signed, fuzzSecret, fuzzSignKey, sha1.New); err != nil {
+		return 0
+	}
+
+	return 1
+}
@@ -0,0 +1,124 @@
+package session
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"net/url"
+	"strings"
+)
+
+const (
+	gcmIVSize  = 12
+	gcmTagSize = 16
+)
+
+// DecryptAuthenticatedCookie decrypts a cookie written by Rails 5.2 or later
+// with use_authenticated_cookie_encryption, which is encrypted with
+// AES-256-GCM and has the form data--iv--authTag.
+func DecryptAuthenticatedCookie(encryptedCookie, secretKeyBase, salt string) ([]byte, error) {
+	return decryptAuthenticatedCookie(encryptedCookie, generateSecret(secretKeyBase, salt))
+}
+
+func decryptAuthenticatedCookie(encryptedCookie string, secret []byte) ([]byte, error) {
+	cookie, err := url.QueryUnescape(encryptedCookie)
+	if err != nil {
+		return nil, err
+	}
+
+	return decryptAuthenticatedMessage(cookie, secret)
+}
+
+func decryptAuthenticatedMessage(message string, secret []byte) ([]byte, error) {
+	vectors := strings.Split(message, "--")
+	if len(vectors) != 3 {
+		return nil, ErrInvalidCookie
+	}
+
+	var (
+		decoded [3][]byte
+		err     error
+	)
+	for i, v := range vectors {
+		if decoded[i], err = base64.StdEncoding.DecodeString(v); err != nil {
+			return nil, ErrInvalidCookie
+		}
+	}
+	data, iv, tag := decoded[0], decoded[1], decoded[2]
+
+	if len(iv) != gcmIVSize || len(tag) != gcmTagSize {
+		return nil, ErrInvalidCookie
+	}
+
+	gcm, err := newGCM(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := gcm.Open(nil, iv, append(data, tag...), nil)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+
+	return session, nil
+}
+
+// EncryptAuthenticatedCookie returns a cookie holding data the way Rails
+// 5.2 or later write it with use_authenticated_cookie_encryption. It is the
+// inverse of DecryptAuthenticatedCookie.
+func EncryptAuthenticatedCookie(data []byte, secretKeyBase, salt string) (string, error) {
+	return encryptAuthenticatedCookie(data, generateSecret(secretKeyBase, salt))
+}
+
+func encryptAuthenticatedCookie(data, secret []byte) (string, error) {
+	message, err := encryptAuthenticatedMessage(data, secret)
+	if err != nil {
+		return "", err
+	}
+
+	return url.QueryEscape(message), nil
+}
+
+func encryptAuthenticatedMessage(data, secret []byte) (string, error) {
+	iv := make([]byte, gcmIVSize)
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return "", err
+	}
+
+	return sealAuthenticatedMessage(data, secret, iv)
+}
+
+func sealAuthenticatedMessage(data, secret, iv []byte) (string, error) {
+	gcm, err := newGCM(secret)
+	if err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nil, iv, data, nil)
+	encrypted, tag := sealed[:len(data)], sealed[len(data):]
+
+	message := base64.StdEncoding.EncodeToString(encrypted) + "--" +
+		base64.StdEncoding.EncodeToString(iv) + "--" +
+		base64.StdEncoding.EncodeToString(tag)
+
+	return message, nil
+}
+
+func newGCM(secret []byte) (cipher.AEAD, error) {
+	c, err := aes.NewCipher(secret[:32])
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(c)
+}
+
+// DecryptCookie decrypts a session cookie of a Rails app using the default
+// salts, telling AES-256-GCM cookies written by Rails 5.2 or later from
+// AES-256-CBC cookies written by earlier versions by their format. Apps using
+// the Rails 7.0 key derivation need Rails70.DecryptCookie instead.
+func DecryptCookie(cookie, secretKeyBase string) ([]byte, error) {
+	return Rails52.DecryptCookie(cookie, secretKeyBase)
+}
@@ -0,0 +1,89 @@
+package session
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const (
+	authenticatedSalt = "authenticated encrypted cookie"
+
+	// The cookie's original content is:
+	// {"session_id":"2d1d2bd9d37c5b6b1c9b5a2fb1ea6c52","_csrf_token":"Hq0cTt/7a7Q1kV7VbFTnXB3mnmEXPDkNRTl6xP0sBq0=","warden.user.user.key":[[1],"$2a$11$6omJ7/e3Ni7Pl7jZbCdDBu"]}
+	authenticatedCookie = "F98aoRyI3qdcrbkaXvTyX9uASsFXnsw4ATY66gNepiQ5Gq%2B7KpcKhjLbU7f0JckTGoGihQYkS5PKQPvynboD60DElrQsYWkVvotchhMkMX7qbKVeWuPuwJoilcdpJwmFduYcI21Va6OC3ilVwBY67Fh61ljsY%2B0SIoDf%2FFETxuY7Z9ajF3QNQbVQ2hioIrY%2FPWjwkkj91R6Khcl6BpmgSFpOF2Cyhcozeiie--MDEyMzQ1Njc4OWFi--PVQvKaf84lKoCAxARR8CFg%3D%3D"
+)
+
+func TestDecryptAuthenticatedCookie(t *testing.T) {
+	cookieData, err := DecryptAuthenticatedCookie(authenticatedCookie, secretKeyBase, authenticatedSalt)
+	if err != nil {
+		t.Fatalf("DecryptAuthenticatedCookie() returned error %v", err)
+	}
+
+	var jsonData map[string]interface{}
+	if err := json.Unmarshal(cookieData, &jsonData); err != nil {
+		t.Fatalf("DecryptAuthenticatedCookie() returned invalid JSON: %v", err)
+	}
+	if jsonData["session_id"] != "2d1d2bd9d37c5b6b1c9b5a2fb1ea6c52" {
+		t.Errorf("DecryptAuthenticatedCookie() returned %s", cookieData)
+	}
+
+	if _, err := DecryptAuthenticatedCookie(authenticatedCookie, secretKeyBase, salt); err != ErrInvalidSignature {
+		t.Errorf("DecryptAuthenticatedCookie() with a wrong salt returned error %v instead of %v", err, ErrInvalidSignature)
+	}
+
+	tampered := strings.Replace(authenticatedCookie, "--PVQv", "--PVQw", 1)
+	if _, err := DecryptAuthenticatedCookie(tampered, secretKeyBase, authenticatedSalt); err != ErrInvalidSignature {
+		t.Errorf("DecryptAuthenticatedCookie() with a tampered tag returned error %v instead of %v", err, ErrInvalidSignature)
+	}
+
+	for _, cookie := range []string{signedCookie, "YQ==--YQ==--YQ==", "YQ==--MDEyMzQ1Njc4OWFi--YQ=="} {
+		if _, err := DecryptAuthenticatedCookie(cookie, secretKeyBase, authenticatedSalt); err != ErrInvalidCookie {
+			t.Errorf("DecryptAuthenticatedCookie(%q) returned error %v instead of %v", cookie, err, ErrInvalidCookie)
+		}
+	}
+}
+
+func TestEncryptAuthenticatedCookie(t *testing.T) {
+	for _, data := range [][]byte{[]byte(`{"session_id":"2d1d2bd9d37c5b6b1c9b5a2fb1ea6c52"}`), {}} {
+		cookie, err := EncryptAuthenticatedCookie(data, secretKeyBase, authenticatedSalt)
+		if err != nil {
+			t.Errorf("EncryptAuthenticatedCookie(%q) returned error %v", data, err)
+			continue
+		}
+
+		decrypted, err := DecryptAuthenticatedCookie(cookie, secretKeyBase, authenticatedSalt)
+		if err != nil {
+			t.Errorf("DecryptAuthenticatedCookie(EncryptAuthenticatedCookie(%q)) returned error %v", data, err)
+			continue
+		}
+
+		if !bytes.Equal(decrypted, data) {
+			t.Errorf("DecryptAuthenticatedCookie(EncryptAuthenticatedCookie(%q)) returned %q", data, decrypted)
+		}
+	}
+
+	// the fixture uses the IV "0123456789ab"
+	data, _ := DecryptAuthenticatedCookie(authenticatedCookie, secretKeyBase, authenticatedSalt)
+	message, err := sealAuthenticatedMessage(data, generateSecret(secretKeyBase, authenticatedSalt), []byte("0123456789ab"))
+	if cookie := url.QueryEscape(message); err != nil || cookie != authenticatedCookie {
+		t.Errorf("sealAuthenticatedMessage() returned %q, %v instead of the fixture cookie", cookie, err)
+	}
+}
+
+func TestDecryptCookie(t *testing.T) {
+	for _, cookie := range []string{signedCookie, authenticatedCookie} {
+		data, err := DecryptCookie(cookie, secretKeyBase)
+		if err != nil {
+			t.Errorf("DecryptCookie(%q) returned error %v", cookie, err)
+			continue
+		}
+
+		var jsonData map[string]interface{}
+		if err := json.Unmarshal(data, &jsonData); err != nil || jsonData["session_id"] == nil {
+			t.Errorf("DecryptCookie(%q) returned %q", cookie, data)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package session
+
+import (
+	"crypto/sha1"
+	"net/url"
+)
+
+// legacyVerifier is the MessageVerifier of Rails 3 cookie sessions, which
+// signs cookies with secret_token itself.
+func legacyVerifier(secretToken string) MessageVerifier {
+	return MessageVerifier{Secret: []byte(secretToken), Digest: sha1.New}
+}
+
+// VerifyLegacyCookie returns the data of a session cookie signed, but not
+// encrypted, with secret_token by Rails 3, or by Rails 4.x apps that still
+// set secret_token. The data is a Marshal dump.
+func VerifyLegacyCookie(cookie, secretToken string) ([]byte, error) {
+	message, err := url.QueryUnescape(cookie)
+	if err != nil {
+		return nil, err
+	}
+
+	return legacyVerifier(secretToken).Verify(message)
+}
+
+// SignLegacyCookie returns a session cookie holding data the way Rails 3
+// writes it, signed with secretToken.
+func SignLegacyCookie(data []byte, secretToken string) string {
+	return url.QueryEscape(legacyVerifier(secretToken).Generate(data))
+}
+
+// UpgradeLegacyCookie returns a cookie encrypted with c, like the cookie jar
+// of Rails 4.x apps setting both secret_token and secret_key_base does. A
+// cookie encrypted with c already is returned as it is, in which case
+// upgraded is false. Otherwise it is verified with secretToken and its data
+// is encrypted.
+func (c Config) UpgradeLegacyCookie(cookie, secretKeyBase, secretToken string) (upgradedCookie string, data []byte, upgraded bool, err error) {
+	if data, err = c.DecryptCookie(cookie, secretKeyBase); err == nil {
+		return cookie, data, false, nil
+	}
+
+	data, err = VerifyLegacyCookie(cookie, secretToken)
+	if err != nil {
+		return "", nil, false, err
+	}
+
+	upgradedCookie, err = c.EncryptCookie(data, secretKeyBase)
+	if err != nil {
+		return "", nil, false, err
+	}
+
+	return upgradedCookie, data, true, nil
+}
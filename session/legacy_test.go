@@ -0,0 +1,96 @@
+package session
+
+import (
+	"bytes"
+	"testing"
+)
+
+const (
+	secretToken  = "3eb6db5a9026c547c72708438d496d942e976b252138db7e4e0ee5edd7539457d3ed6dc6db75f8a2e9c9e8e5a1d2d8f0b2e6f9c8a7d4b3e2f1a0b9c8d7e6f5a4"
+	legacyCookie = "BAh7B0kiD3Nlc3Npb25faWQGOgZFVEkiCGFiYwY7AFRJIgx1c2VyX2lkBjsAVGkG--4b455ea557b4e8a8fc5780c6faefe065f2a61c97"
+)
+
+// {"session_id"=>"abc", "user_id"=>1}
+var legacyData = []byte("\x04\x08{\x07I\"\x0fsession_id\x06:\x06ETI\"\x08abc\x06;\x00TI\"\x0cuser_id\x06;\x00Ti\x06")
+
+type verifyLegacyCookieTestCase struct {
+	Cookie      string
+	SecretToken string
+	Err         error
+}
+
+func TestVerifyLegacyCookie(t *testing.T) {
+	tests := []verifyLegacyCookieTestCase{
+		{legacyCookie, secretToken, nil},
+		{legacyCookie, "another secret token", ErrInvalidSignature},
+		{"BAh7BkkiD3Nlc3Npb25faWQGOgZFVEkiCGFiYwY7AFQ=--4b455ea557b4e8a8fc5780c6faefe065f2a61c97", secretToken, ErrInvalidSignature},
+		{"BAh7B0kiD3Nlc3Npb25faWQGOgZFVEkiCGFiYwY7AFRJIgx1c2VyX2lkBjsAVGkG", secretToken, ErrInvalidCookie},
+	}
+
+	for _, testCase := range tests {
+		data, err := VerifyLegacyCookie(testCase.Cookie, testCase.SecretToken)
+		if err != testCase.Err {
+			t.Errorf("VerifyLegacyCookie(%q) returned error %v instead of %v", testCase.Cookie, err, testCase.Err)
+			continue
+		}
+
+		if err == nil && !bytes.Equal(data, legacyData) {
+			t.Errorf("VerifyLegacyCookie(%q) returned %q instead of %q", testCase.Cookie, data, legacyData)
+		}
+	}
+
+	data, _ := VerifyLegacyCookie(legacyCookie, secretToken)
+	v, err := DecodeValue(data)
+	if err != nil {
+		t.Fatalf("DecodeValue() returned error %v", err)
+	}
+
+	id, err := Lookup(v, "user_id")
+	if err != nil {
+		t.Fatalf("Lookup(user_id) returned error %v", err)
+	}
+	if n, _ := id.Int(); n != 1 {
+		t.Errorf("Lookup(user_id) returned %d instead of 1", n)
+	}
+}
+
+func TestSignLegacyCookie(t *testing.T) {
+	cookie := SignLegacyCookie(legacyData, secretToken)
+	if cookie != legacyCookie {
+		t.Errorf("SignLegacyCookie() returned %s instead of %s", cookie, legacyCookie)
+	}
+
+	// "=" padding is escaped
+	data := []byte("\x04\bi\x06")
+	cookie = SignLegacyCookie(data, secretToken)
+	if verified, err := VerifyLegacyCookie(cookie, secretToken); err != nil || !bytes.Equal(verified, data) {
+		t.Errorf("VerifyLegacyCookie(%q) returned %q, %v instead of %q", cookie, verified, err, data)
+	}
+}
+
+func TestUpgradeLegacyCookie(t *testing.T) {
+	for _, config := range []Config{Rails40, Rails52, Rails70} {
+		cookie, data, upgraded, err := config.UpgradeLegacyCookie(legacyCookie, secretKeyBase, secretToken)
+		if err != nil {
+			t.Errorf("UpgradeLegacyCookie(%q) returned error %v", legacyCookie, err)
+			continue
+		}
+		if !upgraded || !bytes.Equal(data, legacyData) {
+			t.Errorf("UpgradeLegacyCookie(%q) returned %q, %v instead of %q, true", legacyCookie, data, upgraded, legacyData)
+		}
+
+		decrypted, err := config.DecryptCookie(cookie, secretKeyBase)
+		if err != nil || !bytes.Equal(decrypted, legacyData) {
+			t.Errorf("DecryptCookie(%q) returned %q, %v instead of %q", cookie, decrypted, err, legacyData)
+		}
+
+		upgradedCookie, data, upgraded, err := config.UpgradeLegacyCookie(cookie, secretKeyBase, secretToken)
+		if err != nil || upgraded || upgradedCookie != cookie || !bytes.Equal(data, legacyData) {
+			t.Errorf("UpgradeLegacyCookie(%q) upgraded a current cookie: %q, %q, %v, %v", cookie, upgradedCookie, data, upgraded, err)
+		}
+	}
+
+	if _, _, _, err := Rails40.UpgradeLegacyCookie(legacyCookie, secretKeyBase, "another secret token"); err != ErrInvalidSignature {
+		t.Errorf("UpgradeLegacyCookie() returned error %v instead of %v", err, ErrInvalidSignature)
+	}
+}
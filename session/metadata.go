@@ -0,0 +1,175 @@
+package session
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrExpired         = errors.New("session: message expired")
+	ErrPurposeMismatch = errors.New("session: message purpose mismatch")
+)
+
+// CookiePurpose returns the purpose Rails 6.0 and later embed in the
+// metadata of a cookie, e.g. "cookie._app_session".
+func CookiePurpose(name string) string {
+	return cookiePurposePrefix + name
+}
+
+const cookiePurposePrefix = "cookie."
+
+// railsTimeFormat is the format of Time#iso8601(3) in UTC.
+const railsTimeFormat = "2006-01-02T15:04:05.000Z"
+
+type messageEnvelope struct {
+	Rails *messageMetadata `json:"_rails"`
+}
+
+type messageMetadata struct {
+	Message *string `json:"message"`
+	Exp     *string `json:"exp"`
+	Pur     *string `json:"pur"`
+}
+
+// UnwrapMessage returns the message wrapped in the metadata envelope Rails
+// 5.2 to 7.0 put around decrypted data, {"_rails":{"message":...}},
+// verifying that it has the expected purpose and has not expired.
+//
+// Like Rails does for cookies written before use_cookies_with_metadata was
+// enabled, data without an envelope is returned as it is. Cookie purposes
+// also accept envelopes without a purpose, which Rails 5.2 writes for cookies
+// with an expiry time, e.g. sessions with expire_after. See DecodeMessage
+// for the metadata Rails 7.1 puts inside the serialized message.
+func UnwrapMessage(data []byte, purpose string) ([]byte, error) {
+	if !bytes.HasPrefix(data, []byte(`{"_rails":`)) {
+		return data, nil
+	}
+
+	var envelope messageEnvelope
+	if err := json.Unmarshal(data, &envelope); err != nil || envelope.Rails == nil {
+		return nil, ErrInvalidCookie
+	}
+
+	// metadata inside a JSON message, see DecodeMessage
+	if envelope.Rails.Message == nil {
+		return data, nil
+	}
+
+	var exp, pur string
+	if envelope.Rails.Exp != nil {
+		exp = *envelope.Rails.Exp
+	}
+	if envelope.Rails.Pur != nil {
+		pur = *envelope.Rails.Pur
+	}
+
+	if err := verifyMetadata(exp, pur, purpose); err != nil {
+		return nil, err
+	}
+
+	message, err := base64.StdEncoding.DecodeString(*envelope.Rails.Message)
+	if err != nil {
+		return nil, ErrInvalidCookie
+	}
+
+	return message, nil
+}
+
+// WrapMessage returns message in a metadata envelope for purpose, the
+// inverse of UnwrapMessage. A zero expiresAt never expires.
+func WrapMessage(message []byte, purpose string, expiresAt time.Time) []byte {
+	encoded := base64.StdEncoding.EncodeToString(message)
+
+	envelope := messageEnvelope{&messageMetadata{Message: &encoded}}
+
+	if !expiresAt.IsZero() {
+		exp := expiresAt.UTC().Format(railsTimeFormat)
+		envelope.Rails.Exp = &exp
+	}
+	if purpose != "" {
+		envelope.Rails.Pur = &purpose
+	}
+
+	// encoding a struct of strings does not fail
+	data, _ := json.Marshal(envelope)
+
+	return data
+}
+
+// DecodeMessage unwraps decrypted data with UnwrapMessage and returns its
+// Value, see DecodeValue. Metadata Rails 7.1 puts inside the serialized
+// message with use_message_serializer_for_metadata, {"_rails"=>{"data"=>...}},
+// is verified and removed as well.
+func DecodeMessage(data []byte, purpose string) (Value, error) {
+	message, err := UnwrapMessage(data, purpose)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := DecodeValue(message)
+	if err != nil {
+		return nil, err
+	}
+
+	if v.Kind() != Map || v.Len() != 1 {
+		return v, nil
+	}
+
+	rails, err := v.Key("_rails")
+	if err != nil || rails.Kind() != Map {
+		return v, nil
+	}
+
+	value, err := rails.Key("data")
+	if err != nil {
+		return v, nil
+	}
+
+	var exp, pur string
+	if e, err := rails.Key("exp"); err == nil && e.Kind() != Nil {
+		if exp, err = e.Text(); err != nil {
+			return nil, ErrInvalidCookie
+		}
+	}
+	if p, err := rails.Key("pur"); err == nil && p.Kind() != Nil {
+		if pur, err = p.Text(); err != nil {
+			return nil, ErrInvalidCookie
+		}
+	}
+
+	if err := verifyMetadata(exp, pur, purpose); err != nil {
+		return nil, err
+	}
+
+	return value, nil
+}
+
+// verifyMetadata checks the purpose and the expiry time of a message, which
+// Rails writes with iso8601(3). An empty exp never expires.
+//
+// Cookie jars read messages without a purpose as well, as Rails retries to
+// parse a cookie without one when parsing it with its purpose fails.
+func verifyMetadata(exp, pur, purpose string) error {
+	if pur != purpose && !(pur == "" && strings.HasPrefix(purpose, cookiePurposePrefix)) {
+		return ErrPurposeMismatch
+	}
+
+	if exp == "" {
+		return nil
+	}
+
+	expiresAt, err := time.Parse(time.RFC3339, exp)
+	if err != nil {
+		return ErrInvalidCookie
+	}
+
+	if !time.Now().Before(expiresAt) {
+		return ErrExpired
+	}
+
+	return nil
+}
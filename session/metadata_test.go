@@ -0,0 +1,118 @@
+package session
+
+import (
+	"testing"
+	"time"
+
+	"github.com/adjust/gorails/marshal"
+)
+
+type unwrapMessageTestCase struct {
+	Data        string
+	Purpose     string
+	Expectation string
+	Err         error
+}
+
+func TestUnwrapMessage(t *testing.T) {
+	tests := []unwrapMessageTestCase{
+		{`{"_rails":{"message":"eyJzZXNzaW9uX2lkIjoiYWJjIn0=","exp":null,"pur":"cookie._app_session"}}`, "cookie._app_session", `{"session_id":"abc"}`, nil},
+		{`{"_rails":{"message":"eyJzZXNzaW9uX2lkIjoiYWJjIn0=","exp":"2999-01-01T00:00:00.000Z","pur":"cookie._app_session"}}`, "cookie._app_session", `{"session_id":"abc"}`, nil},
+		{`{"_rails":{"message":"eyJzZXNzaW9uX2lkIjoiYWJjIn0=","exp":null,"pur":null}}`, "", `{"session_id":"abc"}`, nil},
+		// written before use_cookies_with_metadata
+		{`{"session_id":"abc"}`, "cookie._app_session", `{"session_id":"abc"}`, nil},
+		{`{"_rails":{"message":"eyJzZXNzaW9uX2lkIjoiYWJjIn0=","exp":null,"pur":"cookie.remember_token"}}`, "cookie._app_session", "", ErrPurposeMismatch},
+		// written by Rails 5.2 for sessions with expire_after
+		{`{"_rails":{"message":"eyJzZXNzaW9uX2lkIjoiYWJjIn0=","exp":"2999-01-01T00:00:00.000Z","pur":null}}`, "cookie._app_session", `{"session_id":"abc"}`, nil},
+		{`{"_rails":{"message":"eyJzZXNzaW9uX2lkIjoiYWJjIn0=","exp":"2999-01-01T00:00:00.000Z"}}`, "cookie._app_session", `{"session_id":"abc"}`, nil},
+		{`{"_rails":{"message":"eyJzZXNzaW9uX2lkIjoiYWJjIn0=","exp":"2001-01-01T00:00:00.000Z","pur":null}}`, "cookie._app_session", "", ErrExpired},
+		{`{"_rails":{"message":"eyJzZXNzaW9uX2lkIjoiYWJjIn0=","exp":null,"pur":null}}`, "login", "", ErrPurposeMismatch},
+		{`{"_rails":{"message":"eyJzZXNzaW9uX2lkIjoiYWJjIn0=","exp":null,"pur":"cookie._app_session"}}`, "", "", ErrPurposeMismatch},
+		{`{"_rails":{"message":"eyJzZXNzaW9uX2lkIjoiYWJjIn0=","exp":"2001-01-01T00:00:00.000Z","pur":"cookie._app_session"}}`, "cookie._app_session", "", ErrExpired},
+		{`{"_rails":{"message":"eyJzZXNzaW9uX2lkIjoiYWJjIn0=","exp":"yesterday","pur":"cookie._app_session"}}`, "cookie._app_session", "", ErrInvalidCookie},
+		{`{"_rails":{"message":"not base64","exp":null,"pur":"cookie._app_session"}}`, "cookie._app_session", "", ErrInvalidCookie},
+		{`{"_rails":{"data":{}}}`, "", `{"_rails":{"data":{}}}`, nil},
+		{`{"_rails":null}`, "", "", ErrInvalidCookie},
+		{`{"_rails":`, "", "", ErrInvalidCookie},
+	}
+
+	for _, testCase := range tests {
+		message, err := UnwrapMessage([]byte(testCase.Data), testCase.Purpose)
+		if err != testCase.Err {
+			t.Errorf("UnwrapMessage(%s, %q) returned error %v instead of %v", testCase.Data, testCase.Purpose, err, testCase.Err)
+			continue
+		}
+
+		if string(message) != testCase.Expectation {
+			t.Errorf("UnwrapMessage(%s, %q) returned %s instead of %s", testCase.Data, testCase.Purpose, message, testCase.Expectation)
+		}
+	}
+}
+
+func TestWrapMessage(t *testing.T) {
+	expiresAt := time.Date(2999, 1, 1, 1, 0, 0, 0, time.FixedZone("CET", 3600))
+
+	data := WrapMessage([]byte(`{"session_id":"abc"}`), CookiePurpose("_app_session"), expiresAt)
+	expected := `{"_rails":{"message":"eyJzZXNzaW9uX2lkIjoiYWJjIn0=","exp":"2999-01-01T00:00:00.000Z","pur":"cookie._app_session"}}`
+	if string(data) != expected {
+		t.Errorf("WrapMessage() returned %s instead of %s", data, expected)
+	}
+
+	data = WrapMessage([]byte(`{}`), "", time.Time{})
+	expected = `{"_rails":{"message":"e30=","exp":null,"pur":null}}`
+	if string(data) != expected {
+		t.Errorf("WrapMessage() returned %s instead of %s", data, expected)
+	}
+}
+
+func TestDecodeMessage(t *testing.T) {
+	purpose := CookiePurpose("_app_session")
+
+	sessionData := marshal.Hash{{Key: "session_id", Value: "abc"}}
+
+	marshalled, _ := marshal.Marshal(marshal.Hash{{Key: "_rails", Value: marshal.Hash{
+		{Key: "data", Value: sessionData},
+		{Key: "pur", Value: purpose},
+	}}})
+
+	expired, _ := marshal.Marshal(marshal.Hash{{Key: "_rails", Value: marshal.Hash{
+		{Key: "data", Value: sessionData},
+		{Key: "exp", Value: "2001-01-01T00:00:00.000Z"},
+		{Key: "pur", Value: purpose},
+	}}})
+
+	for _, data := range [][]byte{
+		[]byte(`{"_rails":{"data":{"session_id":"abc"},"pur":"cookie._app_session"}}`),
+		marshalled,
+		WrapMessage([]byte(`{"session_id":"abc"}`), purpose, time.Now().Add(time.Hour)),
+		[]byte(`{"session_id":"abc"}`),
+	} {
+		v, err := DecodeMessage(data, purpose)
+		if err != nil {
+			t.Errorf("DecodeMessage(%q) returned error %v", data, err)
+			continue
+		}
+
+		id, err := Lookup(v, "session_id")
+		if err != nil {
+			t.Errorf("DecodeMessage(%q) returned a value without session_id: %v", data, err)
+			continue
+		}
+
+		if s, _ := id.Text(); s != "abc" {
+			t.Errorf("DecodeMessage(%q) returned session_id %q instead of abc", data, s)
+		}
+	}
+
+	errorTests := []unwrapMessageTestCase{
+		{`{"_rails":{"data":{"session_id":"abc"},"pur":"cookie.remember_token"}}`, purpose, "", ErrPurposeMismatch},
+		{string(expired), purpose, "", ErrExpired},
+		{`{"_rails":{"data":{},"pur":1}}`, purpose, "", ErrInvalidCookie},
+	}
+
+	for _, testCase := range errorTests {
+		if _, err := DecodeMessage([]byte(testCase.Data), testCase.Purpose); err != testCase.Err {
+			t.Errorf("DecodeMessage(%q) returned error %v instead of %v", testCase.Data, err, testCase.Err)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package session
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"net/url"
+	"strings"
+)
+
+var ErrInvalidSecret = errors.New("session: secret must be at least 64 bytes long")
+
+const (
+	rackEncryptorVersion = 1
+	rackSecretSize       = 32
+	rackSignatureSize    = sha256.Size
+	rackPadSize          = 32
+)
+
+// RackCookie reads and writes session cookies of Rack::Session::Cookie, used
+// by Sinatra and plain Rack apps:
+//
+//	rack := session.RackCookie{Secret: secret}
+//
+//	data, err := rack.Decode(cookie)
+//	v, err := session.DecodeValue(data)
+//
+// The data of a cookie is a Marshal dump or JSON, depending on the coder or
+// the serialize_json option of the app.
+type RackCookie struct {
+	// Secret is the :secret option of the middleware.
+	Secret string
+	// Digest is the :hmac option of signed cookies, sha1.New if nil.
+	Digest func() hash.Hash
+	// Encrypted selects the encrypted format of rack-session 2.x, which is
+	// used when the middleware is given :secrets.
+	Encrypted bool
+	// Key is the :key option, the cookie name, which encrypted cookies are
+	// signed with if it is given to the middleware.
+	Key string
+}
+
+// Decode returns the data of a session cookie, verifying its signature.
+func (r RackCookie) Decode(cookie string) ([]byte, error) {
+	message, err := url.QueryUnescape(cookie)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.Encrypted {
+		return r.decrypt(message)
+	}
+
+	return r.verify(message)
+}
+
+// Encode returns a session cookie holding data, which must be serialized
+// with the coder of the app already.
+func (r RackCookie) Encode(data []byte) (string, error) {
+	if !r.Encrypted {
+		return url.QueryEscape(r.sign(data)), nil
+	}
+
+	message, err := r.encrypt(data)
+	if err != nil {
+		return "", err
+	}
+
+	return url.QueryEscape(message), nil
+}
+
+// verify reads the Base64 coders of Rack, which write data--hexdigest.
+func (r RackCookie) verify(message string) ([]byte, error) {
+	i := strings.LastIndex(message, "--")
+	if i < 0 {
+		return nil, ErrInvalidCookie
+	}
+	encoded, sign := message[:i], message[i+2:]
+
+	expected := hex.EncodeToString(generateSign(r.digest(), encoded, []byte(r.Secret)))
+	if !hmac.Equal([]byte(sign), []byte(expected)) {
+		return nil, ErrInvalidSignature
+	}
+
+	// newlines written by pack('m') are ignored
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidCookie
+	}
+
+	return data, nil
+}
+
+func (r RackCookie) sign(data []byte) string {
+	encoded := packBase64(data)
+
+	return encoded + "--" + hex.EncodeToString(generateSign(r.digest(), encoded, []byte(r.Secret)))
+}
+
+// packBase64 encodes data like Array#pack('m') does, with a newline after
+// every 60 characters and at the end.
+func packBase64(data []byte) string {
+	encoded := base64.StdEncoding.EncodeToString(data)
+
+	lines := make([]string, 0, len(encoded)/60+2)
+	for len(encoded) > 60 {
+		lines = append(lines, encoded[:60])
+		encoded = encoded[60:]
+	}
+	lines = append(lines, encoded, "")
+
+	return strings.Join(lines, "\n")
+}
+
+// decrypt reads the format of Rack::Session::Encryptor: the url-safe base64
+// of version, message secret, IV, AES-256-CTR encrypted payload and
+// HMAC-SHA256 signature. The payload is the little-endian size of the
+// padding, the data and the padding.
+func (r RackCookie) decrypt(message string) ([]byte, error) {
+	cipherSecret, hmacSecret, err := r.secrets()
+	if err != nil {
+		return nil, err
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(message, "="))
+	if err != nil || len(decoded) < 1+rackSecretSize+aes.BlockSize+rackSignatureSize {
+		return nil, ErrInvalidCookie
+	}
+
+	data, signature := decoded[:len(decoded)-rackSignatureSize], decoded[len(decoded)-rackSignatureSize:]
+	if !hmac.Equal(signature, r.signature(hmacSecret, data)) {
+		return nil, ErrInvalidSignature
+	}
+
+	if data[0] != rackEncryptorVersion {
+		return nil, ErrInvalidCookie
+	}
+	messageSecret := data[1 : 1+rackSecretSize]
+	iv := data[1+rackSecretSize : 1+rackSecretSize+aes.BlockSize]
+	encrypted := data[1+rackSecretSize+aes.BlockSize:]
+
+	payload, err := rackCrypt(encrypted, cipherSecret, messageSecret, iv)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(payload) < 2 {
+		return nil, ErrInvalidCookie
+	}
+	padding := int(binary.LittleEndian.Uint16(payload))
+	if padding > len(payload)-2 {
+		return nil, ErrInvalidCookie
+	}
+
+	return payload[2 : len(payload)-padding], nil
+}
+
+func (r RackCookie) encrypt(data []byte) (string, error) {
+	cipherSecret, hmacSecret, err := r.secrets()
+	if err != nil {
+		return "", err
+	}
+
+	padding := rackPadSize - (2+len(data))%rackPadSize
+	payload := make([]byte, 2+len(data)+padding)
+	binary.LittleEndian.PutUint16(payload, uint16(padding))
+	copy(payload[2:], data)
+
+	// message secret, IV and padding
+	random := make([]byte, rackSecretSize+aes.BlockSize+padding)
+	if _, err := io.ReadFull(rand.Reader, random); err != nil {
+		return "", err
+	}
+	copy(payload[2+len(data):], random[rackSecretSize+aes.BlockSize:])
+
+	return r.sealMessage(payload, cipherSecret, hmacSecret, random[:rackSecretSize], random[rackSecretSize:rackSecretSize+aes.BlockSize])
+}
+
+func (r RackCookie) sealMessage(payload, cipherSecret, hmacSecret, messageSecret, iv []byte) (string, error) {
+	encrypted, err := rackCrypt(payload, cipherSecret, messageSecret, iv)
+	if err != nil {
+		return "", err
+	}
+
+	data := make([]byte, 0, 1+len(messageSecret)+len(iv)+len(encrypted)+rackSignatureSize)
+	data = append(data, rackEncryptorVersion)
+	data = append(data, messageSecret...)
+	data = append(data, iv...)
+	data = append(data, encrypted...)
+	data = append(data, r.signature(hmacSecret, data)...)
+
+	return base64.URLEncoding.EncodeToString(data), nil
+}
+
+// secrets splits Secret into the cipher secret, its first 32 bytes, and the
+// HMAC secret, the rest.
+func (r RackCookie) secrets() (cipherSecret, hmacSecret []byte, err error) {
+	if len(r.Secret) < 64 {
+		return nil, nil, ErrInvalidSecret
+	}
+
+	return []byte(r.Secret[:rackSecretSize]), []byte(r.Secret[rackSecretSize:]), nil
+}
+
+func (r RackCookie) signature(hmacSecret, data []byte) []byte {
+	mac := hmac.New(sha256.New, hmacSecret)
+	mac.Write(data)
+	mac.Write([]byte(r.Key))
+
+	return mac.Sum(nil)
+}
+
+func (r RackCookie) digest() func() hash.Hash {
+	if r.Digest == nil {
+		return sha1.New
+	}
+
+	return r.Digest
+}
+
+// rackCrypt encrypts or decrypts data with AES-256-CTR, using a key derived
+// from the message secret of a cookie.
+func rackCrypt(data, cipherSecret, messageSecret, iv []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, cipherSecret)
+	mac.Write(messageSecret)
+
+	c, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, len(data))
+	cipher.NewCTR(c, iv).XORKeyStream(out, data)
+
+	return out, nil
+}
@@ -0,0 +1,137 @@
+package session
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"net/url"
+	"testing"
+)
+
+const (
+	rackCookie          = "BAh7B0kiD3Nlc3Npb25faWQGOgZFVEkiCGFiYwY7AFRJIgx1c2VyX2lkBjsA%0AVGkG%0A--96d877d06259ba350e203bd607303c3174ef6c25"
+	rackEncryptedCookie = "AQABAgMEBQYHCAkKCwwNDg8QERITFBUWFxgZGhscHR4fZGVmZ2hpamtsbW5vcHFyc4GTbi-KowXeVhAEJ3szVlo9crKj8CrK3-BM6J9HqR7-lwp3Ih7LrDDQRgtqN7U9U45LnwqduJ9Co666P9-jA3cyYpltsAn7_qT_fw-TDYIWA6JvxcGnOnK5QMzOMeReqQ%3D%3D"
+)
+
+type rackCookieTestCase struct {
+	Rack        RackCookie
+	Cookie      string
+	Expectation string
+	Err         error
+}
+
+func TestRackCookieDecode(t *testing.T) {
+	tests := []rackCookieTestCase{
+		{RackCookie{Secret: secretToken}, rackCookie, string(legacyData), nil},
+		{
+			RackCookie{Secret: secretToken, Digest: sha256.New},
+			"BAh7B0kiD3Nlc3Npb25faWQGOgZFVEkiCGFiYwY7AFRJIgx1c2VyX2lkBjsA%0AVGkG%0A--46d843546bcb6fbd7ceb5aa27739e25531efb938163d1a7fa7f16cc04f9564eb",
+			string(legacyData),
+			nil,
+		},
+		// Rack::Session::Cookie::Base64::JSON
+		{
+			RackCookie{Secret: secretToken},
+			"eyJzZXNzaW9uX2lkIjoiYWJjIiwidXNlcl9pZCI6MX0%3D%0A--1e780921c9cc1e5e3cb0e8968ac89d6f3050abee",
+			`{"session_id":"abc","user_id":1}`,
+			nil,
+		},
+		{RackCookie{Secret: secretToken, Encrypted: true}, rackEncryptedCookie, string(legacyData), nil},
+		{
+			RackCookie{Secret: secretToken, Encrypted: true, Key: "_app_session"},
+			"AQABAgMEBQYHCAkKCwwNDg8QERITFBUWFxgZGhscHR4fZGVmZ2hpamtsbW5vcHFyc4GTbi-KowXeVhAEJ3szVlo9crKj8CrK3-BM6J9HqR7-lwp3Ih7LrDDQRgtqN7U9U45LnwqduJ9Co666P9-jA3eQ1LZBWIns_KyFHomEKkyccDc44uWZdQQFz1ZSzHZeFg%3D%3D",
+			string(legacyData),
+			nil,
+		},
+		{RackCookie{Secret: "another secret"}, rackCookie, "", ErrInvalidSignature},
+		{RackCookie{Secret: secretToken, Digest: sha256.New}, rackCookie, "", ErrInvalidSignature},
+		{RackCookie{Secret: secretToken}, "BAh7B0kiD3Nlc3Npb25faWQGOgZFVEkiCGFiYwY7AFRJIgx1c2VyX2lkBjsA%0AVGkG%0A", "", ErrInvalidCookie},
+		{RackCookie{Secret: secretToken, Encrypted: true, Key: "_app_session"}, rackEncryptedCookie, "", ErrInvalidSignature},
+		{RackCookie{Secret: secretToken, Encrypted: true}, rackCookie, "", ErrInvalidCookie},
+		{RackCookie{Secret: secretToken, Encrypted: true}, "AQAB", "", ErrInvalidCookie},
+		{RackCookie{Secret: "too short", Encrypted: true}, rackEncryptedCookie, "", ErrInvalidSecret},
+	}
+
+	for _, testCase := range tests {
+		data, err := testCase.Rack.Decode(testCase.Cookie)
+		if err != testCase.Err {
+			t.Errorf("Decode(%q) returned error %v instead of %v", testCase.Cookie, err, testCase.Err)
+			continue
+		}
+
+		if string(data) != testCase.Expectation {
+			t.Errorf("Decode(%q) returned %q instead of %q", testCase.Cookie, data, testCase.Expectation)
+		}
+	}
+
+	data, _ := RackCookie{Secret: secretToken}.Decode(rackCookie)
+	v, err := DecodeValue(data)
+	if err != nil {
+		t.Fatalf("DecodeValue() returned error %v", err)
+	}
+	if id, _ := Lookup(v, "session_id"); id == nil {
+		t.Errorf("DecodeValue() returned a value without session_id")
+	} else if s, _ := id.Text(); s != "abc" {
+		t.Errorf("DecodeValue() returned session_id %q instead of abc", s)
+	}
+}
+
+func TestRackCookieEncode(t *testing.T) {
+	cookie, err := RackCookie{Secret: secretToken}.Encode(legacyData)
+	if err != nil || cookie != rackCookie {
+		t.Errorf("Encode() returned %q, %v instead of %q", cookie, err, rackCookie)
+	}
+
+	long := bytes.Repeat(legacyData, 5)
+	for _, rack := range []RackCookie{
+		{Secret: secretToken},
+		{Secret: secretToken, Digest: sha256.New},
+		{Secret: secretToken, Encrypted: true},
+		{Secret: secretToken, Encrypted: true, Key: "_app_session"},
+	} {
+		for _, data := range [][]byte{legacyData, long, []byte(`{}`)} {
+			cookie, err := rack.Encode(data)
+			if err != nil {
+				t.Errorf("Encode(%q) returned error %v", data, err)
+				continue
+			}
+
+			decoded, err := rack.Decode(cookie)
+			if err != nil || !bytes.Equal(decoded, data) {
+				t.Errorf("Decode(%q) returned %q, %v instead of %q", cookie, decoded, err, data)
+			}
+		}
+	}
+
+	if _, err := (RackCookie{Secret: "too short", Encrypted: true}).Encode(legacyData); err != ErrInvalidSecret {
+		t.Errorf("Encode() returned error %v instead of %v", err, ErrInvalidSecret)
+	}
+}
+
+func TestRackCookieSealMessage(t *testing.T) {
+	rack := RackCookie{Secret: secretToken, Encrypted: true}
+	cipherSecret, hmacSecret, _ := rack.secrets()
+
+	messageSecret := make([]byte, rackSecretSize)
+	for i := range messageSecret {
+		messageSecret[i] = byte(i)
+	}
+	iv := make([]byte, 16)
+	for i := range iv {
+		iv[i] = byte(100 + i)
+	}
+
+	padding := rackPadSize - (2+len(legacyData))%rackPadSize
+	payload := make([]byte, 2+len(legacyData)+padding)
+	binary.LittleEndian.PutUint16(payload, uint16(padding))
+	copy(payload[2:], legacyData)
+
+	message, err := rack.sealMessage(payload, cipherSecret, hmacSecret, messageSecret, iv)
+	if err != nil {
+		t.Fatalf("sealMessage() returned error %v", err)
+	}
+
+	if expected, _ := url.QueryUnescape(rackEncryptedCookie); message != expected {
+		t.Errorf("sealMessage() returned %s instead of %s", message, expected)
+	}
+}
@@ -0,0 +1,81 @@
+package session
+
+import (
+	"net/url"
+)
+
+// Credentials are a secret_key_base and the Config cookies are written with.
+type Credentials struct {
+	SecretKeyBase string
+	Config        Config
+}
+
+// Rotation lists the credentials cookies may have been written with, the
+// current ones first, like the settings passed to cookies.rotate in a Rails
+// app. Cookies written with older credentials, e.g. before a secret was
+// changed or Rails was upgraded, can still be read and rewritten with the
+// current ones, so that users are not signed out:
+//
+//	rotation := session.Rotation{
+//		{SecretKeyBase: newSecret, Config: session.Rails70},
+//		{SecretKeyBase: oldSecret, Config: session.Rails52},
+//	}
+type Rotation []Credentials
+
+// DecryptCookie decrypts cookie with the first credentials it was written
+// with and returns their index. If none match, the error returned for the
+// current credentials is returned.
+func (r Rotation) DecryptCookie(cookie string) (data []byte, index int, err error) {
+	if len(r) == 0 {
+		return nil, -1, ErrInvalidSignature
+	}
+
+	var firstErr error
+	for i, c := range r {
+		data, err = c.Config.DecryptCookie(cookie, c.SecretKeyBase)
+		if err == nil {
+			return data, i, nil
+		}
+
+		if i == 0 {
+			firstErr = err
+		}
+	}
+
+	return nil, -1, firstErr
+}
+
+// EncryptCookie encrypts data with the current credentials.
+func (r Rotation) EncryptCookie(data []byte) (string, error) {
+	if len(r) == 0 {
+		return "", ErrUnsupportedCipher
+	}
+
+	return r[0].Config.EncryptCookie(data, r[0].SecretKeyBase)
+}
+
+// RotateCookie decrypts cookie and returns it encrypted with the current
+// credentials, along with its data. The cookie is returned as it is if it has
+// been written with the current credentials and cipher already, in which case
+// rotated is false and the cookie does not need to be set again. Cookies
+// written with the other cipher, e.g. AES256CBC cookies of an app upgraded to
+// AES256GCM, are rotated.
+func (r Rotation) RotateCookie(cookie string) (rotatedCookie string, data []byte, rotated bool, err error) {
+	data, index, err := r.DecryptCookie(cookie)
+	if err != nil {
+		return "", nil, false, err
+	}
+
+	// DecryptCookie has unescaped the cookie successfully already
+	unescaped, _ := url.QueryUnescape(cookie)
+	if index == 0 && cookieCipher(unescaped) == r[0].Config.Cipher {
+		return cookie, data, false, nil
+	}
+
+	rotatedCookie, err = r.EncryptCookie(data)
+	if err != nil {
+		return "", nil, false, err
+	}
+
+	return rotatedCookie, data, true, nil
+}
@@ -0,0 +1,122 @@
+package session
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+type rotationTestCase struct {
+	Cookie string
+	Index  int
+}
+
+func TestRotationDecryptCookie(t *testing.T) {
+	newSecret := strings.Repeat("ab", 64)
+
+	rotation := Rotation{
+		{SecretKeyBase: newSecret, Config: Rails70},
+		{SecretKeyBase: secretKeyBase, Config: Rails52},
+		{SecretKeyBase: secretKeyBase, Config: Rails40},
+	}
+
+	current, err := Rails70.EncryptCookie([]byte(`{"session_id":"x"}`), newSecret)
+	if err != nil {
+		t.Fatalf("EncryptCookie() returned error %v", err)
+	}
+
+	tests := []rotationTestCase{
+		{current, 0},
+		{authenticatedCookie, 1},
+		// Rails52 reads Rails 4.0 cookies already
+		{signedCookie, 1},
+	}
+
+	for _, testCase := range tests {
+		_, index, err := rotation.DecryptCookie(testCase.Cookie)
+		if err != nil {
+			t.Errorf("DecryptCookie(%q) returned error %v", testCase.Cookie, err)
+			continue
+		}
+
+		if index != testCase.Index {
+			t.Errorf("DecryptCookie(%q) matched credentials %d instead of %d", testCase.Cookie, index, testCase.Index)
+		}
+	}
+
+	if _, index, err := rotation[:1].DecryptCookie(authenticatedCookie); err != ErrInvalidSignature || index != -1 {
+		t.Errorf("DecryptCookie() with the current credentials only returned %d, %v instead of -1, %v", index, err, ErrInvalidSignature)
+	}
+
+	if _, _, err := (Rotation{}).DecryptCookie(authenticatedCookie); err != ErrInvalidSignature {
+		t.Errorf("DecryptCookie() without credentials returned error %v instead of %v", err, ErrInvalidSignature)
+	}
+}
+
+func TestRotationRotateCookie(t *testing.T) {
+	newSecret := strings.Repeat("ab", 64)
+
+	rotation := Rotation{
+		{SecretKeyBase: newSecret, Config: Rails70},
+		{SecretKeyBase: secretKeyBase, Config: Rails40},
+	}
+
+	for _, cookie := range []string{signedCookie, authenticatedCookie} {
+		data, _, err := rotation.DecryptCookie(cookie)
+		if err != nil {
+			t.Fatalf("DecryptCookie(%q) returned error %v", cookie, err)
+		}
+
+		rotatedCookie, rotatedData, rotated, err := rotation.RotateCookie(cookie)
+		if err != nil || !rotated {
+			t.Errorf("RotateCookie(%q) returned %v, %v", cookie, rotated, err)
+			continue
+		}
+
+		if !bytes.Equal(rotatedData, data) {
+			t.Errorf("RotateCookie(%q) returned data %q instead of %q", cookie, rotatedData, data)
+		}
+
+		decrypted, err := Rails70.DecryptCookie(rotatedCookie, newSecret)
+		if err != nil || !bytes.Equal(decrypted, data) {
+			t.Errorf("RotateCookie(%q) returned a cookie decrypted to %q, %v instead of %q", cookie, decrypted, err, data)
+		}
+
+		again, _, rotated, err := rotation.RotateCookie(rotatedCookie)
+		if err != nil || rotated || again != rotatedCookie {
+			t.Errorf("RotateCookie() of a current cookie returned %q, %v, %v", again, rotated, err)
+		}
+	}
+
+	if _, _, _, err := rotation.RotateCookie("garbage--garbage"); err == nil {
+		t.Error("RotateCookie() of an invalid cookie returned no error")
+	}
+}
+
+func TestRotationRotateCookieCipher(t *testing.T) {
+	// Rails52 reads the AES256CBC cookies of Rails40, but writes AES256GCM
+	rotation := Rotation{
+		{SecretKeyBase: secretKeyBase, Config: Rails52},
+		{SecretKeyBase: secretKeyBase, Config: Rails40},
+	}
+
+	rotatedCookie, data, rotated, err := rotation.RotateCookie(signedCookie)
+	if err != nil || !rotated {
+		t.Fatalf("RotateCookie(%q) returned %v, %v", signedCookie, rotated, err)
+	}
+
+	if unescaped, _ := url.QueryUnescape(rotatedCookie); strings.Count(unescaped, "--") != 2 {
+		t.Errorf("RotateCookie(%q) returned %q instead of an AES256GCM cookie", signedCookie, rotatedCookie)
+	}
+
+	decrypted, err := Rails52.DecryptCookie(rotatedCookie, secretKeyBase)
+	if err != nil || !bytes.Equal(decrypted, data) {
+		t.Errorf("RotateCookie(%q) returned a cookie decrypted to %q, %v instead of %q", signedCookie, decrypted, err, data)
+	}
+
+	again, _, rotated, err := rotation.RotateCookie(rotatedCookie)
+	if err != nil || rotated || again != rotatedCookie {
+		t.Errorf("RotateCookie() of a current cookie returned %q, %v, %v", again, rotated, err)
+	}
+}
@@ -4,31 +4,43 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha1"
 	"encoding/base64"
 	"encoding/hex"
 	"errors"
+	"hash"
+	"io"
 	"net/url"
 	"strings"
-
-	"golang.org/x/crypto/pbkdf2"
 )
 
-var ErrInvalidSignature = errors.New("session: signature not verified")
+var (
+	ErrInvalidSignature = errors.New("session: signature not verified")
+	ErrInvalidCookie    = errors.New("session: invalid cookie")
+)
 
 func generateSecret(base, salt string) []byte {
-	return pbkdf2.Key([]byte(base), []byte(salt), keyIterNum, keySize, sha1.New)
+	return Rails40.GenerateKey(base, salt)
 }
 
-// The origin of this snippet can be found at https://gist.github.com/doitian/2a89dc9e4372e55335c9111f576b47bf
-func verifySign(encryptedData, sign, base, signSalt string) (bool, error) {
-	signKey := generateSecret(base, signSalt)
-	signHmac := hmac.New(sha1.New, signKey)
+func generateSign(digest func() hash.Hash, encryptedData string, signKey []byte) []byte {
+	signHmac := hmac.New(digest, signKey)
 	signHmac.Write([]byte(encryptedData))
-	verifySign := signHmac.Sum(nil)
+
+	return signHmac.Sum(nil)
+}
+
+func verifySign(encryptedData, sign, base, signSalt string) (bool, error) {
+	return verifySignWithKey(sha1.New, encryptedData, sign, generateSecret(base, signSalt))
+}
+
+// The origin of this snippet can be found at https://gist.github.com/doitian/2a89dc9e4372e55335c9111f576b47bf
+func verifySignWithKey(digest func() hash.Hash, encryptedData, sign string, signKey []byte) (bool, error) {
+	verifySign := generateSign(digest, encryptedData, signKey)
 	signDecoded, err := hex.DecodeString(sign)
 	if err != nil {
-		return false, err
+		return false, ErrInvalidCookie
 	}
 	if !hmac.Equal(verifySign, signDecoded) {
 		return false, ErrInvalidSignature
@@ -38,15 +50,16 @@ func verifySign(encryptedData, sign, base, signSalt string) (bool, error) {
 
 func decodeCookieData(cookie []byte) (data, iv []byte, err error) {
 	vectors := strings.SplitN(string(cookie), "--", 2)
+	if len(vectors) != 2 {
+		return nil, nil, ErrInvalidCookie
+	}
 
-	data, err = base64.StdEncoding.DecodeString(vectors[0])
-	if err != nil {
-		return
+	if data, err = base64.StdEncoding.DecodeString(vectors[0]); err != nil {
+		return nil, nil, ErrInvalidCookie
 	}
 
-	iv, err = base64.StdEncoding.DecodeString(vectors[1])
-	if err != nil {
-		return
+	if iv, err = base64.StdEncoding.DecodeString(vectors[1]); err != nil {
+		return nil, nil, ErrInvalidCookie
 	}
 
 	return
@@ -54,6 +67,14 @@ func decodeCookieData(cookie []byte) (data, iv []byte, err error) {
 
 func decryptCookie(cookie []byte, secret []byte) (dd []byte, err error) {
 	data, iv, err := decodeCookieData(cookie)
+	if err != nil {
+		return
+	}
+
+	// CryptBlocks panics on partial blocks and NewCBCDecrypter on short IVs
+	if len(iv) != aes.BlockSize || len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, ErrInvalidCookie
+	}
 
 	c, err := aes.NewCipher(secret[:32])
 	if err != nil {
@@ -64,20 +85,32 @@ func decryptCookie(cookie []byte, secret []byte) (dd []byte, err error) {
 	dd = make([]byte, len(data))
 	cfb.CryptBlocks(dd, data)
 
-	return
+	return pkcs7Unpad(dd, aes.BlockSize)
 }
 
+// DecryptSignedCookie decrypts a session cookie written by Rails 4.0 to 5.1,
+// which is encrypted with AES-256-CBC and signed with HMAC-SHA1. It returns
+// ErrInvalidSignature if the cookie has not been signed with the key derived
+// from secretKeyBase and signSalt, and ErrInvalidCookie if it is malformed.
 func DecryptSignedCookie(signedCookie, secretKeyBase, salt, signSalt string) (session []byte, err error) {
+	return decryptSignedCookie(signedCookie, generateSecret(secretKeyBase, salt), generateSecret(secretKeyBase, signSalt), sha1.New)
+}
+
+func decryptSignedCookie(signedCookie string, secret, signKey []byte, digest func() hash.Hash) ([]byte, error) {
 	cookie, err := url.QueryUnescape(signedCookie)
 	if err != nil {
-		return
+		return nil, err
 	}
 
-	vectors := strings.SplitN(cookie, "--", 2)
-	if vectors[0] == "" || vectors[1] == "" {
-		return nil, errors.New("session: invalid cookie")
+	return decryptSignedMessage(cookie, secret, signKey, digest)
+}
+
+func decryptSignedMessage(message string, secret, signKey []byte, digest func() hash.Hash) (session []byte, err error) {
+	vectors := strings.SplitN(message, "--", 2)
+	if len(vectors) != 2 || vectors[0] == "" || vectors[1] == "" {
+		return nil, ErrInvalidCookie
 	}
-	verified, err := verifySign(vectors[0], vectors[1], secretKeyBase, signSalt)
+	verified, err := verifySignWithKey(digest, vectors[0], vectors[1], signKey)
 	if err != nil {
 		return
 	}
@@ -87,10 +120,10 @@ func DecryptSignedCookie(signedCookie, secretKeyBase, salt, signSalt string) (se
 
 	data, err := base64.StdEncoding.DecodeString(vectors[0])
 	if err != nil {
-		return
+		return nil, ErrInvalidCookie
 	}
 
-	session, err = decryptCookie(data, generateSecret(secretKeyBase, salt))
+	session, err = decryptCookie(data, secret)
 	if err != nil {
 		return
 	}
@@ -98,8 +131,79 @@ func DecryptSignedCookie(signedCookie, secretKeyBase, salt, signSalt string) (se
 	return
 }
 
-// Rails 4.0 defaults
-const (
-	keyIterNum = 1000
-	keySize    = 64
-)
+func encryptCookie(data []byte, secret []byte) (cookie string, err error) {
+	c, err := aes.NewCipher(secret[:32])
+	if err != nil {
+		return
+	}
+
+	iv := make([]byte, aes.BlockSize)
+	if _, err = io.ReadFull(rand.Reader, iv); err != nil {
+		return
+	}
+
+	encrypted := pkcs7Pad(data, aes.BlockSize)
+	cipher.NewCBCEncrypter(c, iv).CryptBlocks(encrypted, encrypted)
+
+	return base64.StdEncoding.EncodeToString(encrypted) + "--" + base64.StdEncoding.EncodeToString(iv), nil
+}
+
+func pkcs7Pad(data []byte, blockSize int) []byte {
+	n := blockSize - len(data)%blockSize
+
+	padded := make([]byte, len(data), len(data)+n)
+	copy(padded, data)
+	for i := 0; i < n; i++ {
+		padded = append(padded, byte(n))
+	}
+
+	return padded
+}
+
+func pkcs7Unpad(data []byte, blockSize int) ([]byte, error) {
+	if len(data) == 0 || len(data)%blockSize != 0 {
+		return nil, ErrInvalidCookie
+	}
+
+	n := int(data[len(data)-1])
+	if n == 0 || n > blockSize {
+		return nil, ErrInvalidCookie
+	}
+
+	for _, b := range data[len(data)-n:] {
+		if int(b) != n {
+			return nil, ErrInvalidCookie
+		}
+	}
+
+	return data[:len(data)-n], nil
+}
+
+// EncryptAndSignCookie returns a session cookie holding data the way Rails
+// 4.0 to 5.1 write it, encrypted with AES-256-CBC using a random IV and
+// signed with HMAC-SHA1. It is the inverse of DecryptSignedCookie, so that
+// Go services can sign users in to a Rails app by setting the cookie.
+func EncryptAndSignCookie(data []byte, secretKeyBase, salt, signSalt string) (string, error) {
+	return encryptAndSignCookie(data, generateSecret(secretKeyBase, salt), generateSecret(secretKeyBase, signSalt), sha1.New)
+}
+
+func encryptAndSignCookie(data []byte, secret, signKey []byte, digest func() hash.Hash) (string, error) {
+	message, err := encryptAndSignMessage(data, secret, signKey, digest)
+	if err != nil {
+		return "", err
+	}
+
+	return url.QueryEscape(message), nil
+}
+
+func encryptAndSignMessage(data []byte, secret, signKey []byte, digest func() hash.Hash) (string, error) {
+	encrypted, err := encryptCookie(data, secret)
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.StdEncoding.EncodeToString([]byte(encrypted))
+	sign := hex.EncodeToString(generateSign(digest, encoded, signKey))
+
+	return encoded + "--" + sign, nil
+}
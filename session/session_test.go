@@ -1,6 +1,11 @@
 package session
 
 import (
+	"bytes"
+	"crypto/aes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"net/url"
 	"strings"
@@ -49,3 +54,128 @@ func TestDecryptSignedCookie(t *testing.T) {
 		t.Error("DecryptSignedCookie get wrong values after deserialization")
 	}
 }
+
+type decryptSignedCookieTestCase struct {
+	Cookie string
+	Err    error
+}
+
+// signCookie returns a cookie with a valid signature holding data, which is
+// encrypted data--iv in valid cookies.
+func signCookie(data string, signKey []byte) string {
+	encoded := base64.StdEncoding.EncodeToString([]byte(data))
+	return encoded + "--" + hex.EncodeToString(generateSign(sha1.New, encoded, signKey))
+}
+
+func TestDecryptSignedCookieMalformed(t *testing.T) {
+	signKey := generateSecret(secretKeyBase, signSalt)
+	sign := func(data string) string { return signCookie(data, signKey) }
+	block := base64.StdEncoding.EncodeToString(make([]byte, aes.BlockSize))
+
+	tests := []decryptSignedCookieTestCase{
+		{"", ErrInvalidCookie},
+		{"abc", ErrInvalidCookie},
+		{"abc--", ErrInvalidCookie},
+		{"--abc", ErrInvalidCookie},
+		{"abc--not hex", ErrInvalidCookie},
+		{"abc--5f676b46cb0671630fd33bfec08b6fbf3f858c6a", ErrInvalidSignature},
+		{sign("no separator"), ErrInvalidCookie},
+		{sign("!!!--" + block), ErrInvalidCookie},
+		{sign(block + "--!!!"), ErrInvalidCookie},
+		{sign("--" + block), ErrInvalidCookie},
+		{sign(block + "--"), ErrInvalidCookie},
+		{sign(block + "--" + base64.StdEncoding.EncodeToString(make([]byte, 8))), ErrInvalidCookie},
+		{sign(base64.StdEncoding.EncodeToString(make([]byte, 15)) + "--" + block), ErrInvalidCookie},
+		{sign(base64.StdEncoding.EncodeToString(make([]byte, 33)) + "--" + block), ErrInvalidCookie},
+		// decrypts to invalid padding
+		{sign(block + "--" + block), ErrInvalidCookie},
+	}
+
+	for _, testCase := range tests {
+		if _, err := DecryptSignedCookie(testCase.Cookie, secretKeyBase, salt, signSalt); err != testCase.Err {
+			t.Errorf("DecryptSignedCookie(%q) returned error %v instead of %v", testCase.Cookie, err, testCase.Err)
+		}
+	}
+
+	if _, err := DecryptSignedCookie("%zz", secretKeyBase, salt, signSalt); err == nil {
+		t.Errorf("DecryptSignedCookie(%q) returned no error", "%zz")
+	}
+}
+
+func TestDecryptSignedCookieCorrupted(t *testing.T) {
+	// the keys of DecryptSignedCookie are derived once, PBKDF2 would
+	// dominate the time of the test otherwise
+	secret, signKey := generateSecret(secretKeyBase, salt), generateSecret(secretKeyBase, signSalt)
+
+	decrypt := func(cookie string) {
+		defer func() {
+			if r := recover(); r != nil {
+				t.Errorf("DecryptSignedCookie(%q) panicked: %v", cookie, r)
+			}
+		}()
+
+		decryptSignedCookie(cookie, secret, signKey, sha1.New)
+	}
+
+	message, _ := url.QueryUnescape(signedCookie)
+	payload, _ := base64.StdEncoding.DecodeString(message[:strings.Index(message, "--")])
+
+	for i := range message {
+		flipped := []byte(message)
+		flipped[i] ^= 1 << uint(i%8)
+
+		decrypt(message[:i])
+		decrypt(string(flipped))
+	}
+
+	// re-signed cookies get past the signature to the decryption
+	for i := range payload {
+		flipped := append([]byte(nil), payload...)
+		flipped[i] ^= 1 << uint(i%8)
+
+		decrypt(signCookie(string(payload[:i]), signKey))
+		decrypt(signCookie(string(flipped), signKey))
+	}
+}
+
+func TestEncryptAndSignCookie(t *testing.T) {
+	fixture, err := DecryptSignedCookie(signedCookie, secretKeyBase, salt, signSalt)
+	if err != nil {
+		t.Fatalf("DecryptSignedCookie() returned error %v", err)
+	}
+	for _, data := range [][]byte{fixture, {}, []byte("0123456789abcdef")} {
+		cookie, err := EncryptAndSignCookie(data, secretKeyBase, salt, signSalt)
+		if err != nil {
+			t.Errorf("EncryptAndSignCookie(%q) returned error %v", data, err)
+			continue
+		}
+
+		if strings.ContainsAny(cookie, "+/=") {
+			t.Errorf("EncryptAndSignCookie(%q) returned unescaped cookie %q", data, cookie)
+		}
+
+		decrypted, err := DecryptSignedCookie(cookie, secretKeyBase, salt, signSalt)
+		if err != nil {
+			t.Errorf("DecryptSignedCookie(EncryptAndSignCookie(%q)) returned error %v", data, err)
+			continue
+		}
+
+		if !bytes.Equal(decrypted, data) {
+			t.Errorf("DecryptSignedCookie(EncryptAndSignCookie(%q)) returned %q", data, decrypted)
+		}
+
+		if _, err := DecryptSignedCookie(cookie, secretKeyBase, salt, "wrong signature salt"); err != ErrInvalidSignature {
+			t.Errorf("DecryptSignedCookie() with a wrong signature salt returned error %v instead of %v", err, ErrInvalidSignature)
+		}
+	}
+
+	if bytes.HasSuffix(fixture, []byte{'\r'}) {
+		t.Errorf("DecryptSignedCookie() did not strip the padding of the fixture cookie")
+	}
+
+	a, _ := EncryptAndSignCookie(fixture, secretKeyBase, salt, signSalt)
+	b, _ := EncryptAndSignCookie(fixture, secretKeyBase, salt, signSalt)
+	if a == b {
+		t.Errorf("EncryptAndSignCookie() returned the same cookie twice, the IV is not random")
+	}
+}
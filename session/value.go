@@ -0,0 +1,444 @@
+package session
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/adjust/gorails/marshal"
+	"github.com/adjust/gorails/msgpack"
+)
+
+var (
+	ErrKindMismatch = errors.New("session: value is of a different kind")
+	ErrNotFound     = errors.New("session: value not found")
+)
+
+// Kind is the kind of a Value.
+type Kind byte
+
+const (
+	Invalid Kind = iota // values without a counterpart in all serializers, e.g. Ruby objects of custom classes
+	Nil
+	Bool
+	Integer
+	Float
+	String
+	Array
+	Map
+)
+
+// Value is a read-only view of deserialized session data, so that it can be
+// read the same way whichever cookies_serializer the app uses.
+//
+// Accessors of the wrong kind return ErrKindMismatch. Symbols are strings.
+// Ruby objects are maps of their instance variables, with the leading "@"
+// stripped from the names, and Sets are arrays.
+type Value interface {
+	Kind() Kind
+
+	Bool() (bool, error)
+	Int() (int64, error)
+	Float() (float64, error)
+	Text() (string, error)
+
+	// Len returns the number of elements of an array or entries of a map,
+	// and 0 for other kinds.
+	Len() int
+	// Index returns the i-th element of an array or ErrNotFound.
+	Index(i int) (Value, error)
+	// Key returns the entry of a map or ErrNotFound.
+	Key(key string) (Value, error)
+	// Keys returns the sorted keys of a map.
+	Keys() []string
+}
+
+// Lookup follows path from v through map keys and array indices, e.g.
+// Lookup(v, "warden.user.user.key", "0", "0") for the ID of a user signed in
+// with Devise.
+func Lookup(v Value, path ...string) (Value, error) {
+	for _, key := range path {
+		var err error
+
+		switch v.Kind() {
+		case Array:
+			i, convErr := strconv.Atoi(key)
+			if convErr != nil {
+				return nil, ErrNotFound
+			}
+			v, err = v.Index(i)
+		case Map:
+			v, err = v.Key(key)
+		default:
+			return nil, ErrNotFound
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return v, nil
+}
+
+// DecodeValue returns the Value of decrypted session data written by the
+// :marshal, :json, :hybrid or :message_pack cookies serializer.
+func DecodeValue(data []byte) (Value, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0x04, 0x08}):
+		obj, err := marshal.NewDecoder(bytes.NewReader(data)).Decode()
+		if err != nil {
+			return nil, err
+		}
+
+		return FromMarshal(obj), nil
+	case bytes.HasPrefix(data, []byte{0xcc, 0x80}):
+		return FromMessagePack(data)
+	}
+
+	return FromJSON(data)
+}
+
+// FromMarshal returns the Value of a Ruby Marshal dump.
+func FromMarshal(obj *marshal.MarshalledObject) Value {
+	return marshalValue{obj}
+}
+
+// FromJSON returns the Value of a JSON document.
+func FromJSON(data []byte) (Value, error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	return treeValue{v}, nil
+}
+
+// FromMessagePack returns the Value of a message written by the Rails 7.1
+// :message_pack serializer, see msgpack.Decode. Times, durations and other
+// values without a JSON counterpart are of kind Invalid.
+func FromMessagePack(data []byte) (Value, error) {
+	v, err := msgpack.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return treeValue{v}, nil
+}
+
+type marshalValue struct {
+	obj *marshal.MarshalledObject
+}
+
+func (v marshalValue) Kind() Kind {
+	if _, err := v.obj.GetAsSet(); err == nil {
+		return Array
+	}
+	if _, err := v.obj.GetAsOpenStruct(); err == nil {
+		return Map
+	}
+
+	switch v.obj.GetType() {
+	case marshal.TYPE_NIL:
+		return Nil
+	case marshal.TYPE_BOOL:
+		return Bool
+	case marshal.TYPE_INTEGER:
+		return Integer
+	case marshal.TYPE_FLOAT:
+		return Float
+	case marshal.TYPE_STRING:
+		return String
+	case marshal.TYPE_ARRAY:
+		return Array
+	case marshal.TYPE_MAP, marshal.TYPE_OBJECT:
+		return Map
+	}
+
+	return Invalid
+}
+
+func (v marshalValue) Bool() (bool, error) {
+	value, err := v.obj.GetAsBool()
+	return value, marshalError(err)
+}
+
+func (v marshalValue) Int() (int64, error) {
+	value, err := v.obj.GetAsInteger()
+	return value, marshalError(err)
+}
+
+func (v marshalValue) Float() (float64, error) {
+	value, err := v.obj.GetAsFloat()
+	return value, marshalError(err)
+}
+
+func (v marshalValue) Text() (string, error) {
+	value, err := v.obj.GetAsString()
+	return value, marshalError(err)
+}
+
+func (v marshalValue) Len() int {
+	if items, err := v.elements(); err == nil {
+		return len(items)
+	}
+	if items, err := v.entries(); err == nil {
+		return len(items)
+	}
+
+	return 0
+}
+
+func (v marshalValue) Index(i int) (Value, error) {
+	items, err := v.elements()
+	if err != nil {
+		return nil, err
+	}
+
+	if i < 0 || i >= len(items) {
+		return nil, ErrNotFound
+	}
+
+	return marshalValue{items[i]}, nil
+}
+
+func (v marshalValue) Key(key string) (Value, error) {
+	items, err := v.entries()
+	if err != nil {
+		return nil, err
+	}
+
+	item, ok := items[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return marshalValue{item}, nil
+}
+
+func (v marshalValue) Keys() []string {
+	items, _ := v.entries()
+
+	keys := make([]string, 0, len(items))
+	for k := range items {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func (v marshalValue) elements() ([]*marshal.MarshalledObject, error) {
+	if items, err := v.obj.GetAsSet(); err == nil {
+		return items, nil
+	}
+
+	items, err := v.obj.GetAsArray()
+	return items, marshalError(err)
+}
+
+func (v marshalValue) entries() (map[string]*marshal.MarshalledObject, error) {
+	if items, err := v.obj.GetAsOpenStruct(); err == nil {
+		return items, nil
+	}
+
+	switch v.obj.GetType() {
+	case marshal.TYPE_MAP:
+		return v.obj.GetAsMap()
+	case marshal.TYPE_OBJECT:
+		ivars, _ := v.obj.GetAsObject()
+
+		items := make(map[string]*marshal.MarshalledObject, len(ivars))
+		for k, item := range ivars {
+			items[strings.TrimPrefix(k, "@")] = item
+		}
+
+		return items, nil
+	}
+
+	return nil, ErrKindMismatch
+}
+
+func marshalError(err error) error {
+	if err == marshal.TypeMismatch {
+		return ErrKindMismatch
+	}
+
+	return err
+}
+
+// treeValue wraps values decoded into Go types by encoding/json or package
+// msgpack.
+type treeValue struct {
+	v interface{}
+}
+
+func (v treeValue) Kind() Kind {
+	switch x := v.v.(type) {
+	case nil:
+		return Nil
+	case bool:
+		return Bool
+	case json.Number:
+		if _, err := x.Int64(); err == nil {
+			return Integer
+		}
+		return Float
+	case int64:
+		return Integer
+	case *big.Int:
+		if x.IsInt64() {
+			return Integer
+		}
+	case float64:
+		return Float
+	case string, marshal.Symbol, []byte:
+		return String
+	case []interface{}, msgpack.Set:
+		return Array
+	case map[string]interface{}, marshal.Hash:
+		return Map
+	}
+
+	return Invalid
+}
+
+func (v treeValue) Bool() (bool, error) {
+	if b, ok := v.v.(bool); ok {
+		return b, nil
+	}
+
+	return false, ErrKindMismatch
+}
+
+func (v treeValue) Int() (int64, error) {
+	if v.Kind() != Integer {
+		return 0, ErrKindMismatch
+	}
+
+	switch x := v.v.(type) {
+	case json.Number:
+		return x.Int64()
+	case *big.Int:
+		return x.Int64(), nil
+	}
+
+	return v.v.(int64), nil
+}
+
+func (v treeValue) Float() (float64, error) {
+	if v.Kind() != Float {
+		return 0, ErrKindMismatch
+	}
+
+	if n, ok := v.v.(json.Number); ok {
+		return n.Float64()
+	}
+
+	return v.v.(float64), nil
+}
+
+func (v treeValue) Text() (string, error) {
+	switch x := v.v.(type) {
+	case string:
+		return x, nil
+	case marshal.Symbol:
+		return string(x), nil
+	case []byte:
+		return string(x), nil
+	}
+
+	return "", ErrKindMismatch
+}
+
+func (v treeValue) Len() int {
+	switch x := v.v.(type) {
+	case []interface{}:
+		return len(x)
+	case msgpack.Set:
+		return len(x)
+	case map[string]interface{}:
+		return len(x)
+	case marshal.Hash:
+		return len(x)
+	}
+
+	return 0
+}
+
+func (v treeValue) Index(i int) (Value, error) {
+	var items []interface{}
+	switch x := v.v.(type) {
+	case []interface{}:
+		items = x
+	case msgpack.Set:
+		items = x
+	default:
+		return nil, ErrKindMismatch
+	}
+
+	if i < 0 || i >= len(items) {
+		return nil, ErrNotFound
+	}
+
+	return treeValue{items[i]}, nil
+}
+
+func (v treeValue) Key(key string) (Value, error) {
+	switch x := v.v.(type) {
+	case map[string]interface{}:
+		if item, ok := x[key]; ok {
+			return treeValue{item}, nil
+		}
+	case marshal.Hash:
+		for _, p := range x {
+			if hashKey(p.Key) == key {
+				return treeValue{p.Value}, nil
+			}
+		}
+	default:
+		return nil, ErrKindMismatch
+	}
+
+	return nil, ErrNotFound
+}
+
+func (v treeValue) Keys() []string {
+	var keys []string
+	switch x := v.v.(type) {
+	case map[string]interface{}:
+		for k := range x {
+			keys = append(keys, k)
+		}
+	case marshal.Hash:
+		for _, p := range x {
+			keys = append(keys, hashKey(p.Key))
+		}
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// hashKey returns the string a key of a Ruby hash is looked up by, as the
+// marshal package does for GetAsMap.
+func hashKey(key interface{}) string {
+	switch k := key.(type) {
+	case string:
+		return k
+	case marshal.Symbol:
+		return string(k)
+	case []byte:
+		return string(k)
+	}
+
+	return fmt.Sprint(key)
+}
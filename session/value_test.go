@@ -0,0 +1,193 @@
+package session
+
+import (
+	"testing"
+	"time"
+
+	"github.com/adjust/gorails/marshal"
+	"github.com/adjust/gorails/msgpack"
+)
+
+const sessionJSON = `{"session_id":"b858","count":3,"ratio":0.5,"admin":false,"flash":null,"warden.user.user.key":[[1],"$2a$11$6omJ"]}`
+
+func sessionValues(t *testing.T) map[string]Value {
+	hash := marshal.Hash{
+		{Key: "session_id", Value: "b858"},
+		{Key: "count", Value: 3},
+		{Key: "ratio", Value: 0.5},
+		{Key: "admin", Value: false},
+		{Key: "flash", Value: nil},
+		{Key: "warden.user.user.key", Value: []interface{}{[]int{1}, "$2a$11$6omJ"}},
+	}
+
+	dump, err := marshal.Marshal(hash)
+	if err != nil {
+		t.Fatalf("marshal.Marshal() returned an error: %v", err)
+	}
+
+	message, err := msgpack.Encode(hash)
+	if err != nil {
+		t.Fatalf("msgpack.Encode() returned an error: %v", err)
+	}
+
+	values := make(map[string]Value)
+	for name, data := range map[string][]byte{"marshal": dump, "json": []byte(sessionJSON), "message_pack": message} {
+		if values[name], err = DecodeValue(data); err != nil {
+			t.Fatalf("DecodeValue() returned an error for %s data: %v", name, err)
+		}
+	}
+
+	return values
+}
+
+type lookupTestCase struct {
+	Path []string
+	Kind Kind
+	Err  error
+}
+
+func TestLookup(t *testing.T) {
+	tests := []lookupTestCase{
+		{nil, Map, nil},
+		{[]string{"session_id"}, String, nil},
+		{[]string{"count"}, Integer, nil},
+		{[]string{"ratio"}, Float, nil},
+		{[]string{"admin"}, Bool, nil},
+		{[]string{"flash"}, Nil, nil},
+		{[]string{"warden.user.user.key"}, Array, nil},
+		{[]string{"warden.user.user.key", "0", "0"}, Integer, nil},
+		{[]string{"warden.user.user.key", "2"}, Invalid, ErrNotFound},
+		{[]string{"warden.user.user.key", "x"}, Invalid, ErrNotFound},
+		{[]string{"session_id", "0"}, Invalid, ErrNotFound},
+		{[]string{"missing"}, Invalid, ErrNotFound},
+	}
+
+	for name, session := range sessionValues(t) {
+		for _, testCase := range tests {
+			v, err := Lookup(session, testCase.Path...)
+			if err != testCase.Err {
+				t.Errorf("Lookup(%v) returned %v instead of %v for %s data", testCase.Path, err, testCase.Err, name)
+				continue
+			}
+
+			if err == nil && v.Kind() != testCase.Kind {
+				t.Errorf("Lookup(%v) returned a value of kind %d instead of %d for %s data", testCase.Path, v.Kind(), testCase.Kind, name)
+			}
+		}
+	}
+}
+
+func TestValueAccessors(t *testing.T) {
+	for name, session := range sessionValues(t) {
+		if keys := session.Keys(); len(keys) != 6 || keys[0] != "admin" || keys[5] != "warden.user.user.key" {
+			t.Errorf("Keys() returned %v for %s data", keys, name)
+		}
+
+		id, _ := session.Key("session_id")
+		if s, err := id.Text(); err != nil || s != "b858" {
+			t.Errorf("Text() returned %q, %v for %s data", s, err, name)
+		}
+		if _, err := id.Int(); err != ErrKindMismatch {
+			t.Errorf("Int() returned %v instead of ErrKindMismatch for a string in %s data", err, name)
+		}
+
+		count, _ := session.Key("count")
+		if i, err := count.Int(); err != nil || i != 3 {
+			t.Errorf("Int() returned %d, %v for %s data", i, err, name)
+		}
+
+		ratio, _ := session.Key("ratio")
+		if f, err := ratio.Float(); err != nil || f != 0.5 {
+			t.Errorf("Float() returned %v, %v for %s data", f, err, name)
+		}
+
+		admin, _ := session.Key("admin")
+		if b, err := admin.Bool(); err != nil || b {
+			t.Errorf("Bool() returned %v, %v for %s data", b, err, name)
+		}
+
+		key, _ := session.Key("warden.user.user.key")
+		if n := key.Len(); n != 2 {
+			t.Errorf("Len() returned %d for %s data", n, name)
+		}
+		if _, err := key.Key("0"); err != ErrKindMismatch {
+			t.Errorf("Key() returned %v instead of ErrKindMismatch for an array in %s data", err, name)
+		}
+	}
+}
+
+func TestDecodeValueCookie(t *testing.T) {
+	cookieData, err := DecryptSignedCookie(signedCookie, secretKeyBase, salt, signSalt)
+	if err != nil {
+		t.Fatalf("DecryptSignedCookie() returned an error: %v", err)
+	}
+
+	session, err := DecodeValue(cookieData)
+	if err != nil {
+		t.Fatalf("DecodeValue() returned an error: %v", err)
+	}
+
+	v, err := Lookup(session, "flash", "flashes", "notice")
+	if err != nil {
+		t.Fatalf("Lookup() returned an error: %v", err)
+	}
+	if s, _ := v.Text(); s != "Welcome! You have signed up successfully." {
+		t.Errorf("Lookup() returned %q", s)
+	}
+}
+
+type decodeValueErrorTestCase struct {
+	Data []byte
+	Err  error
+}
+
+func TestDecodeValueTruncated(t *testing.T) {
+	tests := []decodeValueErrorTestCase{
+		{[]byte{4, 8}, marshal.IncompleteData},
+		{[]byte{4, 8, 105}, marshal.IncompleteData},
+		{[]byte{4, 8, 34}, marshal.IncompleteData},
+		{[]byte{4, 8, 111, 58, 6, 65}, marshal.IncompleteData},
+		{[]byte{4, 8, 108, 43}, marshal.IncompleteData},
+	}
+
+	for _, testCase := range tests {
+		if v, err := DecodeValue(testCase.Data); err != testCase.Err {
+			t.Errorf("DecodeValue(%q) returned %v, %v instead of error %v", testCase.Data, v, err, testCase.Err)
+		}
+	}
+}
+
+func TestFromMarshalObject(t *testing.T) {
+	dump, _ := marshal.Marshal(marshal.Object{Class: "User", Ivars: map[string]interface{}{"@id": 1}})
+
+	v, err := Lookup(FromMarshal(marshal.CreateMarshalledObject(dump)), "id")
+	if err != nil {
+		t.Fatalf("Lookup() returned an error: %v", err)
+	}
+	if i, _ := v.Int(); i != 1 {
+		t.Errorf("Lookup() returned %d", i)
+	}
+}
+
+func TestFromMessagePack(t *testing.T) {
+	message, _ := msgpack.Encode(marshal.Hash{
+		{Key: marshal.Symbol("user_id"), Value: 7},
+		{Key: "tags", Value: msgpack.Set{"a"}},
+		{Key: "seen_at", Value: time.Unix(1700000000, 0)},
+	})
+
+	session, err := DecodeValue(message)
+	if err != nil {
+		t.Fatalf("DecodeValue() returned an error: %v", err)
+	}
+
+	if v, err := Lookup(session, "user_id"); err != nil || v.Kind() != Integer {
+		t.Errorf("Lookup() returned %v, %v for a symbol key", v, err)
+	}
+	if v, err := Lookup(session, "tags", "0"); err != nil || v.Kind() != String {
+		t.Errorf("Lookup() returned %v, %v for a set element", v, err)
+	}
+	if v, _ := session.Key("seen_at"); v.Kind() != Invalid {
+		t.Errorf("Key() returned a value of kind %d for a time", v.Kind())
+	}
+}
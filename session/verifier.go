@@ -0,0 +1,98 @@
+package session
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"hash"
+	"net/url"
+	"strings"
+)
+
+// MessageVerifier reads and writes messages signed, but not encrypted, by
+// ActiveSupport::MessageVerifier, which have the form data--digest.
+//
+// Verified data may hold metadata, see DecodeMessage. Wrap data with
+// WrapMessage to add metadata to generated messages.
+type MessageVerifier struct {
+	Secret []byte
+	// Digest is the HMAC digest, sha1.New if nil as in Rails.
+	Digest func() hash.Hash
+	// URLSafe selects the url_safe encoding of Rails 7.1.
+	URLSafe bool
+}
+
+// Generate returns the signed message holding data.
+func (v MessageVerifier) Generate(data []byte) string {
+	encoded := v.encoding().EncodeToString(data)
+
+	return encoded + "--" + hex.EncodeToString(generateSign(v.digest(), encoded, v.Secret))
+}
+
+// Verify returns the data of a signed message, or ErrInvalidSignature if it
+// has not been signed with Secret.
+func (v MessageVerifier) Verify(message string) ([]byte, error) {
+	// The url_safe encoding may contain "--" itself.
+	i := len(message) - 2*v.digest()().Size() - 2
+	if i <= 0 || message[i:i+2] != "--" {
+		return nil, ErrInvalidCookie
+	}
+	encoded, sign := message[:i], message[i+2:]
+
+	expected := hex.EncodeToString(generateSign(v.digest(), encoded, v.Secret))
+	if !hmac.Equal([]byte(sign), []byte(expected)) {
+		return nil, ErrInvalidSignature
+	}
+
+	if v.URLSafe {
+		encoded = strings.TrimRight(encoded, "=")
+	}
+
+	data, err := v.encoding().DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidCookie
+	}
+
+	return data, nil
+}
+
+func (v MessageVerifier) digest() func() hash.Hash {
+	if v.Digest == nil {
+		return sha1.New
+	}
+
+	return v.Digest
+}
+
+func (v MessageVerifier) encoding() *base64.Encoding {
+	if v.URLSafe {
+		return base64.RawURLEncoding
+	}
+
+	return base64.StdEncoding
+}
+
+// SignedCookieVerifier returns the MessageVerifier of cookies.signed.
+func (c Config) SignedCookieVerifier(secretKeyBase string) MessageVerifier {
+	return MessageVerifier{
+		Secret: c.GenerateKey(secretKeyBase, c.SignedCookieSalt),
+		Digest: c.SignedCookieDigest,
+	}
+}
+
+// VerifySignedCookie returns the data of a cookie written to cookies.signed,
+// e.g. a user ID or a remember token.
+func (c Config) VerifySignedCookie(cookie, secretKeyBase string) ([]byte, error) {
+	message, err := url.QueryUnescape(cookie)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.SignedCookieVerifier(secretKeyBase).Verify(message)
+}
+
+// SignCookie returns a cookie holding data the way cookies.signed writes it.
+func (c Config) SignCookie(data []byte, secretKeyBase string) string {
+	return url.QueryEscape(c.SignedCookieVerifier(secretKeyBase).Generate(data))
+}
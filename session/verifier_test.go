@@ -0,0 +1,100 @@
+package session
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"strings"
+	"testing"
+)
+
+type verifySignedCookieTestCase struct {
+	Config      Config
+	Cookie      string
+	Expectation string
+	Err         error
+}
+
+func TestVerifySignedCookie(t *testing.T) {
+	tests := []verifySignedCookieTestCase{
+		{Rails40, "NDI%3D--a7c3b5617264f9be8c396f5e11b685fd81971ab6", "42", nil},
+		{
+			Rails70,
+			"eyJfcmFpbHMiOnsibWVzc2FnZSI6Ik5EST0iLCJleHAiOm51bGwsInB1ciI6ImNvb2tpZS51c2VyX2lkIn19--287b8937d4a531f07730daed10c4e343d8077188e3d61a19433c815b599442f6",
+			`{"_rails":{"message":"NDI=","exp":null,"pur":"cookie.user_id"}}`,
+			nil,
+		},
+		{Rails70, "NDI%3D--a7c3b5617264f9be8c396f5e11b685fd81971ab6", "", ErrInvalidCookie},
+		{Rails40, "NDI%3D--a7c3b5617264f9be8c396f5e11b685fd81971ab7", "", ErrInvalidSignature},
+		{Rails40, "NDM%3D--a7c3b5617264f9be8c396f5e11b685fd81971ab6", "", ErrInvalidSignature},
+		{Rails40, "--a7c3b5617264f9be8c396f5e11b685fd81971ab6", "", ErrInvalidCookie},
+	}
+
+	for _, testCase := range tests {
+		data, err := testCase.Config.VerifySignedCookie(testCase.Cookie, secretKeyBase)
+		if err != testCase.Err {
+			t.Errorf("VerifySignedCookie(%q) returned error %v instead of %v", testCase.Cookie, err, testCase.Err)
+			continue
+		}
+
+		if string(data) != testCase.Expectation {
+			t.Errorf("VerifySignedCookie(%q) returned %s instead of %s", testCase.Cookie, data, testCase.Expectation)
+		}
+	}
+
+	data, _ := Rails70.VerifySignedCookie(tests[1].Cookie, secretKeyBase)
+	v, err := DecodeMessage(data, CookiePurpose("user_id"))
+	if err != nil {
+		t.Fatalf("DecodeMessage() returned error %v", err)
+	}
+	if id, _ := v.Int(); id != 42 {
+		t.Errorf("DecodeMessage() returned %d instead of 42", id)
+	}
+}
+
+func TestSignCookie(t *testing.T) {
+	if cookie := Rails40.SignCookie([]byte("42"), secretKeyBase); cookie != "NDI%3D--a7c3b5617264f9be8c396f5e11b685fd81971ab6" {
+		t.Errorf("SignCookie() returned %s", cookie)
+	}
+
+	for _, config := range []Config{Rails40, Rails70} {
+		data := []byte(`{"remember_token":"abc"}`)
+
+		cookie := config.SignCookie(data, secretKeyBase)
+		verified, err := config.VerifySignedCookie(cookie, secretKeyBase)
+		if err != nil || !bytes.Equal(verified, data) {
+			t.Errorf("VerifySignedCookie(SignCookie()) returned %q, %v", verified, err)
+		}
+	}
+}
+
+func TestMessageVerifierURLSafe(t *testing.T) {
+	v := MessageVerifier{Secret: Rails70.GenerateKey(secretKeyBase, DefaultSignedCookieSalt), Digest: sha256.New, URLSafe: true}
+
+	message := "-_8iaGki--4cbc988058963ca0a8173263845ac235b8ded27eb4ae4a5457f4df1c5ad6384b"
+	data, err := v.Verify(message)
+	if err != nil || string(data) != "\xfb\xff\"hi\"" {
+		t.Errorf("Verify(%q) returned %q, %v", message, data, err)
+	}
+
+	if generated := v.Generate(data); generated != message {
+		t.Errorf("Generate(%q) returned %s instead of %s", data, generated, message)
+	}
+
+	if strings.ContainsAny(v.Generate([]byte{0xff, 0xff}), "+/=") {
+		t.Errorf("Generate() returned a message that is not URL safe")
+	}
+}
+
+func TestMessageVerifierDefaultDigest(t *testing.T) {
+	v := MessageVerifier{Secret: Rails40.GenerateKey(secretKeyBase, Rails40.SignedCookieSalt)}
+
+	message := "NDI=--a7c3b5617264f9be8c396f5e11b685fd81971ab6"
+	data, err := v.Verify(message)
+	if err != nil || string(data) != "42" {
+		t.Errorf("Verify(%q) returned %q, %v", message, data, err)
+	}
+
+	if generated := v.Generate(data); generated != message {
+		t.Errorf("Generate(%q) returned %s instead of %s", data, generated, message)
+	}
+}
@@ -0,0 +1,895 @@
+package yaml
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var ErrSyntax = errors.New("yaml: syntax error")
+
+type nodeKind int
+
+const (
+	scalarNode nodeKind = iota
+	sequenceNode
+	mappingNode
+	aliasNode
+)
+
+// node is a node of a parsed document. Empty nodes are plain scalars with
+// an empty value.
+type node struct {
+	kind nodeKind
+	// tag is the explicit tag of the node with the secondary handle written
+	// as !!, e.g. "!!str" or "!ruby/object:Foo".
+	tag string
+	// quoted is set for scalars in any style but plain, which are strings
+	// regardless of their value.
+	quoted  bool
+	value   string
+	content []*node
+	alias   *node
+}
+
+// parser reads the subset of YAML Psych writes: block and flow collections,
+// all scalar styles, tags, anchors and aliases. Tabs are not accepted as
+// indentation.
+type parser struct {
+	s       string
+	pos     int
+	anchors map[string]*node
+}
+
+// parse returns the root node of the first document in data, nil if there
+// is none.
+func parse(data []byte) (*node, error) {
+	p := &parser{
+		s:       strings.Replace(string(data), "\r\n", "\n", -1),
+		anchors: make(map[string]*node),
+	}
+
+	// directives
+	for p.skipBlankLines(); p.peek() == '%' && p.column() == 0; p.skipBlankLines() {
+		p.skipLine()
+	}
+
+	compact := true
+	switch {
+	case p.eof() || p.atDocumentMarker("..."):
+		return nil, nil
+	case p.atDocumentMarker("---"):
+		p.pos += 3
+		compact = false
+	}
+
+	root, err := p.parseNode(-1, compact, false)
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipBlankLines()
+	if !p.eof() && !p.atDocumentMarker("---") && !p.atDocumentMarker("...") {
+		return nil, ErrSyntax
+	}
+
+	return root, nil
+}
+
+// parseNode parses the node at the current position, which is a child of
+// the block collection at column indent, or of the document if indent is -1.
+// compact allows block collections to start on the current line, like in
+// "- key: value", and mappingValue allows sequences on the following lines
+// to be indented like the mapping itself.
+func (p *parser) parseNode(indent int, compact, mappingValue bool) (*node, error) {
+	n := &node{}
+
+	p.skipBlanks()
+	if err := p.parseProperties(n, false); err != nil {
+		return nil, err
+	}
+
+	if !p.atLineEnd() {
+		return n, p.parseContent(n, indent, compact)
+	}
+
+	// the content is on the following lines, if any
+	p.skipBlankLines()
+	if p.eof() || p.atDocumentMarker("---") || p.atDocumentMarker("...") {
+		return n, nil
+	}
+
+	switch column := p.column(); {
+	case column > indent:
+		if err := p.parseProperties(n, false); err != nil {
+			return nil, err
+		}
+
+		return n, p.parseContent(n, indent, true)
+	case column == indent && mappingValue && p.atSequenceEntry():
+		return n, p.parseSequence(n, column)
+	}
+
+	return n, nil
+}
+
+func (p *parser) parseContent(n *node, indent int, compact bool) error {
+	column := p.column()
+
+	switch c := p.peek(); {
+	case compact && c == '-' && isSpaceOrEnd(p.at(1)):
+		return p.parseSequence(n, column)
+	case compact && (c == '?' && isSpaceOrEnd(p.at(1)) || p.atImplicitKey()):
+		return p.parseMapping(n, column)
+	case c == '|' || c == '>':
+		return p.parseBlockScalar(n, indent)
+	case c == '*':
+		if err := p.parseAlias(n, false); err != nil {
+			return err
+		}
+	case c == '[' || c == '{':
+		if err := p.parseFlowContent(n); err != nil {
+			return err
+		}
+	case c == '"' || c == '\'':
+		if err := p.parseQuoted(n); err != nil {
+			return err
+		}
+	default:
+		if err := p.parsePlain(n, indent); err != nil {
+			return err
+		}
+	}
+
+	return p.endLine()
+}
+
+func (p *parser) parseSequence(n *node, column int) error {
+	n.kind = sequenceNode
+
+	for {
+		p.pos++ // -
+
+		item, err := p.parseNode(column, true, false)
+		if err != nil {
+			return err
+		}
+		n.content = append(n.content, item)
+
+		p.skipBlankLines()
+		if p.eof() || p.atDocumentMarker("---") || p.atDocumentMarker("...") || p.column() < column {
+			return nil
+		}
+		if p.column() > column {
+			return ErrSyntax
+		}
+
+		// the next key of a mapping the sequence is a value of
+		if !p.atSequenceEntry() {
+			return nil
+		}
+	}
+}
+
+func (p *parser) parseMapping(n *node, column int) error {
+	n.kind = mappingNode
+
+	for {
+		var key, value *node
+		var err error
+
+		if p.peek() == '?' && isSpaceOrEnd(p.at(1)) {
+			p.pos++
+			if key, err = p.parseNode(column, true, false); err != nil {
+				return err
+			}
+
+			p.skipBlankLines()
+			if p.column() == column && p.peek() == ':' && isSpaceOrEnd(p.at(1)) {
+				p.pos++
+				if value, err = p.parseNode(column, true, true); err != nil {
+					return err
+				}
+			} else {
+				value = &node{}
+			}
+		} else {
+			if key, err = p.parseKey(); err != nil {
+				return err
+			}
+
+			p.pos++ // :
+			if value, err = p.parseNode(column, false, true); err != nil {
+				return err
+			}
+		}
+		n.content = append(n.content, key, value)
+
+		p.skipBlankLines()
+		if p.eof() || p.atDocumentMarker("---") || p.atDocumentMarker("...") || p.column() < column {
+			return nil
+		}
+		if p.column() > column || !(p.peek() == '?' && isSpaceOrEnd(p.at(1)) || p.atImplicitKey()) {
+			return ErrSyntax
+		}
+	}
+}
+
+// parseKey parses an implicit key, which ends with ":" on the current line.
+func (p *parser) parseKey() (*node, error) {
+	key := &node{}
+	if err := p.parseProperties(key, false); err != nil {
+		return nil, err
+	}
+
+	switch p.peek() {
+	case '*':
+		if err := p.parseAlias(key, false); err != nil {
+			return nil, err
+		}
+	case '"', '\'':
+		if err := p.parseQuoted(key); err != nil {
+			return nil, err
+		}
+	default:
+		key.value = p.scanPlainLine(false)
+	}
+
+	p.skipBlanks()
+	if p.peek() != ':' {
+		return nil, ErrSyntax
+	}
+
+	return key, nil
+}
+
+// parseProperties parses the tag and the anchor of a node.
+func (p *parser) parseProperties(n *node, flow bool) error {
+	for {
+		switch p.peek() {
+		case '!':
+			if n.tag != "" {
+				return ErrSyntax
+			}
+			n.tag = normalizeTag(p.scanToken(flow))
+		case '&':
+			name := p.scanToken(flow)[1:]
+			if name == "" {
+				return ErrSyntax
+			}
+			p.anchors[name] = n
+		default:
+			return nil
+		}
+
+		if flow {
+			p.skipFlowSpace()
+		} else {
+			p.skipBlanks()
+		}
+	}
+}
+
+func (p *parser) parseAlias(n *node, flow bool) error {
+	target, ok := p.anchors[p.scanToken(flow)[1:]]
+	if !ok || n.tag != "" {
+		return ErrSyntax
+	}
+
+	n.kind, n.alias = aliasNode, target
+
+	return nil
+}
+
+// parsePlain parses a plain scalar, which may continue on the following
+// lines if they are indented more than its parent collection.
+func (p *parser) parsePlain(n *node, indent int) error {
+	c := p.peek()
+	if strings.IndexByte(",[]{}#&*!|>'\"%@`", c) >= 0 || (c == '-' || c == '?' || c == ':') && isSpaceOrEnd(p.at(1)) {
+		return ErrSyntax
+	}
+
+	value := p.scanPlainLine(false)
+
+	for {
+		p.skipBlanks()
+		if p.peek() != '\n' {
+			break
+		}
+
+		end := p.pos
+		breaks := 0
+		for p.peek() == '\n' {
+			p.pos++
+			breaks++
+			p.skipBlanks()
+		}
+
+		if p.eof() || p.column() <= indent || p.peek() == '#' || p.atDocumentMarker("---") || p.atDocumentMarker("...") {
+			p.pos = end
+			break
+		}
+
+		if breaks == 1 {
+			value += " "
+		} else {
+			value += strings.Repeat("\n", breaks-1)
+		}
+		value += p.scanPlainLine(false)
+	}
+
+	n.value = value
+
+	return nil
+}
+
+// scanPlainLine returns the plain scalar on the rest of the current line,
+// which ends before ": ", " #" and in flow context before flow indicators.
+func (p *parser) scanPlainLine(flow bool) string {
+	start, end := p.pos, p.pos
+
+	for !p.eof() {
+		c := p.peek()
+		if c == '\n' ||
+			c == ':' && (isSpaceOrEnd(p.at(1)) || flow && isFlowIndicator(p.at(1))) ||
+			c == '#' && p.pos > start && isBlank(p.s[p.pos-1]) ||
+			flow && isFlowIndicator(c) {
+			break
+		}
+
+		p.pos++
+		if !isBlank(c) {
+			end = p.pos
+		}
+	}
+
+	p.pos = end
+
+	return p.s[start:end]
+}
+
+func (p *parser) parseQuoted(n *node) error {
+	quote := p.peek()
+	p.pos++
+
+	var buf bytes.Buffer
+	for {
+		if p.eof() {
+			return ErrSyntax
+		}
+
+		switch c := p.peek(); {
+		case c == quote && quote == '\'' && p.at(1) == '\'':
+			buf.WriteByte('\'')
+			p.pos += 2
+		case c == quote:
+			p.pos++
+			n.quoted, n.value = true, buf.String()
+			return nil
+		case c == '\\' && quote == '"' && p.at(1) == '\n':
+			p.pos += 2
+			p.skipBlanks()
+		case c == '\\' && quote == '"':
+			if err := p.scanEscape(&buf); err != nil {
+				return err
+			}
+		case c == '\n':
+			// fold the line break, trimming the whitespace around it
+			trimmed := bytes.TrimRight(buf.Bytes(), " \t")
+			buf.Truncate(len(trimmed))
+
+			breaks := 0
+			for p.peek() == '\n' {
+				p.pos++
+				breaks++
+				p.skipBlanks()
+			}
+
+			if breaks == 1 {
+				buf.WriteByte(' ')
+			} else {
+				buf.WriteString(strings.Repeat("\n", breaks-1))
+			}
+		default:
+			buf.WriteByte(c)
+			p.pos++
+		}
+	}
+}
+
+var escapes = map[byte]string{
+	'0': "\x00", 'a': "\a", 'b': "\b", 't': "\t", '\t': "\t", 'n': "\n",
+	'v': "\v", 'f': "\f", 'r': "\r", 'e': "\x1b", ' ': " ", '"': "\"",
+	'/': "/", '\\': "\\", 'N': "\u0085", '_': "\u00a0", 'L': "\u2028",
+	'P': "\u2029",
+}
+
+var escapeSizes = map[byte]int{'x': 2, 'u': 4, 'U': 8}
+
+func (p *parser) scanEscape(buf *bytes.Buffer) error {
+	c := p.at(1)
+	p.pos += 2
+
+	if s, ok := escapes[c]; ok {
+		buf.WriteString(s)
+		return nil
+	}
+
+	size, ok := escapeSizes[c]
+	if !ok || p.pos+size > len(p.s) {
+		return ErrSyntax
+	}
+
+	r, err := strconv.ParseUint(p.s[p.pos:p.pos+size], 16, 32)
+	if err != nil {
+		return ErrSyntax
+	}
+	p.pos += size
+
+	if c == 'x' {
+		// Psych escapes bytes of binary strings with \x
+		buf.WriteByte(byte(r))
+		return nil
+	}
+
+	encoded := make([]byte, utf8.UTFMax)
+	buf.Write(encoded[:utf8.EncodeRune(encoded, rune(r))])
+
+	return nil
+}
+
+// parseBlockScalar parses a literal or folded scalar of a collection at
+// column indent.
+func (p *parser) parseBlockScalar(n *node, indent int) error {
+	literal := p.peek() == '|'
+	p.pos++
+
+	chomp, increment := 0, 0
+	for i := 0; i < 2; i++ {
+		switch c := p.peek(); {
+		case c == '-' && chomp == 0:
+			chomp = -1
+		case c == '+' && chomp == 0:
+			chomp = 1
+		case c >= '1' && c <= '9' && increment == 0:
+			increment = int(c - '0')
+		default:
+			i = 2
+			continue
+		}
+		p.pos++
+	}
+
+	if err := p.endLine(); err != nil {
+		return err
+	}
+
+	blockIndent := increment
+	if increment > 0 && indent >= 0 {
+		blockIndent = indent + increment
+	} else if increment == 0 {
+		blockIndent = p.detectBlockIndent(indent)
+	}
+
+	var lines []string
+	for !p.eof() {
+		end := strings.Index(p.s[p.pos:], "\n")
+		next := p.pos + end + 1
+		if end < 0 {
+			end, next = len(p.s)-p.pos, len(p.s)
+		}
+		line := p.s[p.pos : p.pos+end]
+
+		if strings.Trim(line, " ") == "" {
+			if len(line) > blockIndent {
+				lines = append(lines, line[blockIndent:])
+			} else {
+				lines = append(lines, "")
+			}
+		} else if len(line)-len(strings.TrimLeft(line, " ")) < blockIndent {
+			break
+		} else {
+			lines = append(lines, line[blockIndent:])
+		}
+
+		p.pos = next
+	}
+
+	// trailing empty lines are subject to chomping
+	content := len(lines)
+	for content > 0 && lines[content-1] == "" {
+		content--
+	}
+	trailing := len(lines) - content
+
+	var value string
+	if literal {
+		value = strings.Join(lines[:content], "\n")
+	} else {
+		value = foldLines(lines[:content])
+	}
+
+	switch {
+	case chomp == 1:
+		value += strings.Repeat("\n", trailing+1)
+		if content == 0 {
+			value = value[1:]
+		}
+	case chomp == 0 && content > 0:
+		value += "\n"
+	}
+
+	n.quoted, n.value = true, value
+
+	return nil
+}
+
+// detectBlockIndent returns the indentation of the first non-empty line of
+// a block scalar.
+func (p *parser) detectBlockIndent(indent int) int {
+	blockIndent := 0
+
+	for i := p.pos; i < len(p.s); {
+		spaces := 0
+		for i < len(p.s) && p.s[i] == ' ' {
+			i++
+			spaces++
+		}
+		if spaces > blockIndent {
+			blockIndent = spaces
+		}
+
+		if i < len(p.s) && p.s[i] != '\n' {
+			break
+		}
+		i++
+	}
+
+	if blockIndent < indent+1 {
+		blockIndent = indent + 1
+	}
+	if blockIndent < 1 {
+		blockIndent = 1
+	}
+
+	return blockIndent
+}
+
+// foldLines joins the lines of a folded scalar. Line breaks between lines
+// of text become spaces, unless one of them is more indented.
+func foldLines(lines []string) string {
+	var buf bytes.Buffer
+
+	prev, breaks := -1, 0
+	for i, line := range lines {
+		if line == "" {
+			breaks++
+			continue
+		}
+
+		switch {
+		case prev < 0:
+			buf.WriteString(strings.Repeat("\n", breaks))
+		case breaks == 0 && !isMoreIndented(lines[prev]) && !isMoreIndented(line):
+			buf.WriteByte(' ')
+		case !isMoreIndented(lines[prev]) && !isMoreIndented(line):
+			buf.WriteString(strings.Repeat("\n", breaks))
+		default:
+			buf.WriteString(strings.Repeat("\n", breaks+1))
+		}
+
+		buf.WriteString(line)
+		prev, breaks = i, 0
+	}
+
+	return buf.String()
+}
+
+func isMoreIndented(line string) bool {
+	return line != "" && isBlank(line[0])
+}
+
+// parseFlowContent parses a flow collection or a node inside one, which may
+// span lines regardless of their indentation.
+func (p *parser) parseFlowContent(n *node) error {
+	switch p.peek() {
+	case '[':
+		n.kind = sequenceNode
+		p.pos++
+
+		for {
+			p.skipFlowSpace()
+			if p.peek() == ']' {
+				p.pos++
+				return nil
+			}
+
+			item, err := p.parseFlowNode()
+			if err != nil {
+				return err
+			}
+
+			// single pair mapping
+			p.skipFlowSpace()
+			if p.peek() == ':' {
+				p.pos++
+				value, err := p.parseFlowNode()
+				if err != nil {
+					return err
+				}
+				item = &node{kind: mappingNode, content: []*node{item, value}}
+			}
+			n.content = append(n.content, item)
+
+			if err := p.flowSeparator(']'); err != nil {
+				return err
+			}
+		}
+	case '{':
+		n.kind = mappingNode
+		p.pos++
+
+		for {
+			p.skipFlowSpace()
+			if p.peek() == '}' {
+				p.pos++
+				return nil
+			}
+
+			key, err := p.parseFlowNode()
+			if err != nil {
+				return err
+			}
+
+			value := &node{}
+			p.skipFlowSpace()
+			if p.peek() == ':' {
+				p.pos++
+				if value, err = p.parseFlowNode(); err != nil {
+					return err
+				}
+			}
+			n.content = append(n.content, key, value)
+
+			if err := p.flowSeparator('}'); err != nil {
+				return err
+			}
+		}
+	case '*':
+		return p.parseAlias(n, true)
+	case '"', '\'':
+		return p.parseQuoted(n)
+	case ',', ']', '}':
+		return nil
+	}
+
+	if p.eof() || p.peek() == '#' {
+		return ErrSyntax
+	}
+	n.value = p.scanPlainLine(true)
+
+	return nil
+}
+
+func (p *parser) parseFlowNode() (*node, error) {
+	n := &node{}
+
+	p.skipFlowSpace()
+	if err := p.parseProperties(n, true); err != nil {
+		return nil, err
+	}
+
+	return n, p.parseFlowContent(n)
+}
+
+// flowSeparator skips the comma after an entry of a flow collection, which
+// is optional before its end.
+func (p *parser) flowSeparator(end byte) error {
+	p.skipFlowSpace()
+
+	switch p.peek() {
+	case ',':
+		p.pos++
+	case end:
+	default:
+		return ErrSyntax
+	}
+
+	return nil
+}
+
+// scanToken returns a tag, an anchor or an alias, which end at whitespace
+// and in flow context at flow indicators.
+func (p *parser) scanToken(flow bool) string {
+	start := p.pos
+	for !p.eof() && !isSpaceOrEnd(p.peek()) && !(flow && isFlowIndicator(p.peek())) {
+		p.pos++
+	}
+
+	return p.s[start:p.pos]
+}
+
+// normalizeTag returns tag with the secondary handle, e.g. !!str for
+// !<tag:yaml.org,2002:str>. The non-specific tag ! makes scalars strings.
+func normalizeTag(tag string) string {
+	if strings.HasPrefix(tag, "!<") && strings.HasSuffix(tag, ">") {
+		tag = tag[2 : len(tag)-1]
+		if strings.HasPrefix(tag, "tag:yaml.org,2002:") {
+			return "!!" + tag[len("tag:yaml.org,2002:"):]
+		}
+	}
+
+	if tag == "!" {
+		return "!!str"
+	}
+
+	return tag
+}
+
+// atImplicitKey reports whether the current line holds an implicit mapping
+// key, i.e. a scalar followed by ": ".
+func (p *parser) atImplicitKey() bool {
+	i := p.pos
+
+	// properties and aliases
+	for i < len(p.s) && (p.s[i] == '!' || p.s[i] == '&' || p.s[i] == '*') {
+		for i < len(p.s) && !isSpaceOrEnd(p.s[i]) {
+			i++
+		}
+		for i < len(p.s) && isBlank(p.s[i]) {
+			i++
+		}
+	}
+
+	if i >= len(p.s) {
+		return false
+	}
+
+	switch quote := p.s[i]; quote {
+	case '"', '\'':
+		for i++; i < len(p.s) && p.s[i] != '\n'; i++ {
+			if quote == '"' && p.s[i] == '\\' {
+				i++
+			} else if p.s[i] == quote && quote == '\'' && i+1 < len(p.s) && p.s[i+1] == '\'' {
+				i++
+			} else if p.s[i] == quote {
+				break
+			}
+		}
+		if i >= len(p.s) || p.s[i] != quote {
+			return false
+		}
+
+		for i++; i < len(p.s) && isBlank(p.s[i]); i++ {
+		}
+
+		return i < len(p.s) && p.s[i] == ':' && (i+1 == len(p.s) || isSpaceOrEnd(p.s[i+1]))
+	case '[', '{', '#', '|', '>', '%', '@', '`':
+		return false
+	}
+
+	for ; i < len(p.s) && p.s[i] != '\n'; i++ {
+		switch {
+		case p.s[i] == ':' && (i+1 == len(p.s) || isSpaceOrEnd(p.s[i+1])):
+			return true
+		case p.s[i] == '#' && i > p.pos && isBlank(p.s[i-1]):
+			return false
+		}
+	}
+
+	return false
+}
+
+func (p *parser) atSequenceEntry() bool {
+	return p.peek() == '-' && isSpaceOrEnd(p.at(1))
+}
+
+func (p *parser) atDocumentMarker(marker string) bool {
+	return p.column() == 0 && strings.HasPrefix(p.s[p.pos:], marker) && isSpaceOrEnd(p.at(3))
+}
+
+// atLineEnd reports whether the rest of the current line is empty or a
+// comment.
+func (p *parser) atLineEnd() bool {
+	i := p.pos
+	for i < len(p.s) && isBlank(p.s[i]) {
+		i++
+	}
+
+	return i == len(p.s) || p.s[i] == '\n' || p.s[i] == '#' && (i == 0 || isSpaceOrEnd(p.s[i-1]))
+}
+
+// endLine skips the rest of the current line, which may only hold a
+// comment.
+func (p *parser) endLine() error {
+	if !p.atLineEnd() {
+		return ErrSyntax
+	}
+
+	p.skipLine()
+
+	return nil
+}
+
+func (p *parser) skipLine() {
+	if i := strings.Index(p.s[p.pos:], "\n"); i >= 0 {
+		p.pos += i + 1
+	} else {
+		p.pos = len(p.s)
+	}
+}
+
+// skipBlankLines moves to the first character of the next line with
+// content, skipping comments.
+func (p *parser) skipBlankLines() {
+	for {
+		p.skipBlanks()
+
+		switch p.peek() {
+		case '#':
+			p.skipLine()
+		case '\n':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+// skipFlowSpace skips whitespace, line breaks and comments in flow
+// collections.
+func (p *parser) skipFlowSpace() {
+	for {
+		switch p.peek() {
+		case ' ', '\t', '\n':
+			p.pos++
+		case '#':
+			p.skipLine()
+		default:
+			return
+		}
+	}
+}
+
+func (p *parser) skipBlanks() {
+	for isBlank(p.peek()) {
+		p.pos++
+	}
+}
+
+func (p *parser) column() int {
+	return p.pos - strings.LastIndex(p.s[:p.pos], "\n") - 1
+}
+
+func (p *parser) eof() bool {
+	return p.pos >= len(p.s)
+}
+
+func (p *parser) peek() byte {
+	return p.at(0)
+}
+
+// at returns the byte i bytes after the current position, 0 at the end.
+func (p *parser) at(i int) byte {
+	if p.pos+i >= len(p.s) {
+		return 0
+	}
+
+	return p.s[p.pos+i]
+}
+
+func isBlank(c byte) bool {
+	return c == ' ' || c == '\t'
+}
+
+// isSpaceOrEnd reports whether c is whitespace, a line break or the 0 at
+// the end of the document.
+func isSpaceOrEnd(c byte) bool {
+	return isBlank(c) || c == '\n' || c == 0
+}
+
+func isFlowIndicator(c byte) bool {
+	return c == ',' || c == '[' || c == ']' || c == '{' || c == '}'
+}
@@ -0,0 +1,68 @@
+package yaml
+
+import (
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []loadTestCase{
+		{"--- |\n  a\n  b\n\n", `"a\nb\n"`},
+		{"--- |-\n  a\n\n  b\n", `"a\n\nb"`},
+		{"--- |+\n  a\n\n", `"a\n\n"`},
+		{"--- >\n  a\n  b\n\n  c\n    d\n  e\n", `"a b\nc\n  d\ne\n"`},
+		{"---\nkey: |2-\n    indented\n   x\n", `{"key"=>"  indented\n x"}`},
+		{"--- this is a long\n  plain scalar\n\n  with a break\n", `"this is a long plain scalar\nwith a break"`},
+		{"---\ndesc: this is a long\n  plain scalar\nnext: 1\n", `{"desc"=>"this is a long plain scalar", "next"=>1}`},
+		{"--- 'it''s\n  folded'\n", `"it's folded"`},
+		{"--- \"tab\\there \\x41\\u00e9 \\\n  joined\"\n", `"tab\there Aé joined"`},
+		{"--- [1, two, :three, [], {}]\n", `[1, "two", :three, [], {}]`},
+		{"--- {a: 1, 'b': [x, y], c: }\n", `{"a"=>1, "b"=>["x", "y"], "c"=>nil}`},
+		{"--- [\n  1,\n  2\n]\n", "[1, 2]"},
+		{"# comment\n%YAML 1.1\n---\n- a # trailing\n# between\n- b\n", `["a", "b"]`},
+		{"---\n- - a\n  - b\n- - c\n", `[["a", "b"], ["c"]]`},
+		{"---\n- a: 1\n  b:\n  - x\n- c: 2\n", `[{"a"=>1, "b"=>["x"]}, {"c"=>2}]`},
+		{"---\n-\n  a: 1\n-\n", `[{"a"=>1}, nil]`},
+		{"---\n? - a\n: 1\n", `{["a"]=>1}`},
+		{"a: 1\nb: 2\n", `{"a"=>1, "b"=>2}`},
+		{"---\nempty:\n", `{"empty"=>nil}`},
+		{"--- foo\n...\n--- bar\n", `"foo"`},
+		{"--- ! 42\n", `"42"`},
+		{"--- !<tag:yaml.org,2002:str> 42\n", `"42"`},
+		{"---\n- \"a: b\"\n- 'c # d'\n- e#f\n", `["a: b", "c # d", "e#f"]`},
+		{"---\n:foo: &1\n  x: 1\n:bar: *1\n", `{:foo=>{"x"=>1}, :bar=>{"x"=>1}}`},
+		{"--- !ruby/object:Foo {}\n", "#<Foo>"},
+	}
+
+	for _, testCase := range tests {
+		obj, err := Load([]byte(testCase.Document))
+		if err != nil {
+			t.Errorf("Load(%q) returned an error: %v", testCase.Document, err)
+			continue
+		}
+
+		if value := obj.Inspect(); value != testCase.Expectation {
+			t.Errorf("Load(%q) returned %s instead of %s", testCase.Document, value, testCase.Expectation)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []loadErrorTestCase{
+		{"--- [1, 2\n", ErrSyntax},
+		{"--- {a: 1\n", ErrSyntax},
+		{"--- 'open\n", ErrSyntax},
+		{"--- \"\\q\"\n", ErrSyntax},
+		{"a: 1\n  b: 2\n", ErrSyntax},
+		{"---\na: 1\n- b\n", ErrSyntax},
+		{"- a\nb: 1\n", ErrSyntax},
+		{"--- a: b\n", ErrSyntax},
+		{"--- *x\n", ErrSyntax},
+		{"--- !a !b c\n", ErrSyntax},
+	}
+
+	for _, testCase := range tests {
+		if _, err := Load([]byte(testCase.Document)); err != testCase.Error {
+			t.Errorf("Load(%q) returned %v instead of %v", testCase.Document, err, testCase.Error)
+		}
+	}
+}
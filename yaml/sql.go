@@ -0,0 +1,34 @@
+package yaml
+
+import (
+	"errors"
+)
+
+var ErrInvalidColumnValue = errors.New("yaml: column value is not a YAML document")
+
+// Column makes database columns holding YAML documents, e.g. of attributes
+// declared with `serialize :data`, readable with database/sql:
+//
+//	var prefs map[string]interface{}
+//	err := row.Scan(&id, &yaml.Column{V: &prefs})
+//
+// Scan decodes the column into V with Unmarshal, so V must be a pointer.
+// NULL is decoded like an empty document, i.e. nil. See marshal.Column for
+// columns holding Marshal dumps.
+type Column struct {
+	V interface{}
+}
+
+// Scan implements the database/sql.Scanner interface.
+func (c *Column) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case nil:
+		return Unmarshal(nil, c.V)
+	case []byte:
+		return Unmarshal(s, c.V)
+	case string:
+		return Unmarshal([]byte(s), c.V)
+	}
+
+	return ErrInvalidColumnValue
+}
@@ -0,0 +1,34 @@
+package yaml
+
+import (
+	"reflect"
+	"testing"
+)
+
+type columnScanTestCase struct {
+	Src         interface{}
+	Expectation map[string]interface{}
+	Err         error
+}
+
+func TestColumnScan(t *testing.T) {
+	tests := []columnScanTestCase{
+		{[]byte("---\ntheme: dark\n:count: 2\n"), map[string]interface{}{"theme": "dark", "count": int64(2)}, nil},
+		{"--- !ruby/hash:ActiveSupport::HashWithIndifferentAccess\ntheme: dark\n", map[string]interface{}{"theme": "dark"}, nil},
+		{nil, nil, nil},
+		{42, nil, ErrInvalidColumnValue},
+		{"--- !ruby/regexp /a/\n", nil, ErrUnsupportedTag},
+	}
+
+	for _, testCase := range tests {
+		var prefs map[string]interface{}
+		if err := (&Column{V: &prefs}).Scan(testCase.Src); err != testCase.Err {
+			t.Errorf("Scan(%v) returned %v instead of %v", testCase.Src, err, testCase.Err)
+			continue
+		}
+
+		if !reflect.DeepEqual(prefs, testCase.Expectation) {
+			t.Errorf("Scan(%v) decoded %v instead of %v", testCase.Src, prefs, testCase.Expectation)
+		}
+	}
+}
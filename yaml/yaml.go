@@ -0,0 +1,383 @@
+// Package yaml decodes YAML documents written by Ruby's Psych library, e.g.
+// Delayed::Job handlers or attributes serialized by ActiveRecord, into the
+// values of package marshal. Ruby objects tagged with !ruby/object,
+// !ruby/struct, !ruby/sym and similar tags become the same values as their
+// Marshal dumps, so that the accessors of marshal.MarshalledObject and
+// marshal.Unmarshal work for both formats.
+package yaml
+
+import (
+	"encoding/base64"
+	"errors"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/adjust/gorails/marshal"
+)
+
+var (
+	ErrUnsupportedTag = errors.New("yaml: unsupported tag")
+	ErrMalformedValue = errors.New("yaml: malformed Ruby value")
+	ErrRecursiveAlias = errors.New("yaml: recursive alias")
+)
+
+// Load decodes the first document in data.
+//
+// Plain scalars are resolved as Psych does, e.g. yes and on are true and
+// :foo is a symbol. Timestamps and dates are kept as strings. Subclasses of
+// Hash, Array and String are decoded as instances of the base class.
+func Load(data []byte) (*marshal.MarshalledObject, error) {
+	root, err := parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+	if root != nil {
+		d := &decoder{building: make(map[*node]bool)}
+
+		if value, err = d.value(root); err != nil {
+			return nil, err
+		}
+	}
+
+	dump, err := marshal.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return marshal.CreateMarshalledObject(dump), nil
+}
+
+// Unmarshal decodes the first document in data and stores the result in the
+// value pointed to by v, see marshal.Unmarshal.
+func Unmarshal(data []byte, v interface{}) error {
+	obj, err := Load(data)
+	if err != nil {
+		return err
+	}
+
+	return obj.Unmarshal(v)
+}
+
+type decoder struct {
+	// building holds the nodes being decoded, so that aliases referring to
+	// their own ancestors are detected.
+	building map[*node]bool
+}
+
+func (d *decoder) value(n *node) (interface{}, error) {
+	if n.kind == aliasNode {
+		if d.building[n.alias] {
+			return nil, ErrRecursiveAlias
+		}
+
+		return d.value(n.alias)
+	}
+
+	d.building[n] = true
+	defer delete(d.building, n)
+
+	if n.tag == "" {
+		return d.plain(n)
+	}
+
+	switch tag := n.tag; tag {
+	case "!!str", "!!int", "!!float", "!!bool", "!!null", "!!map", "!!seq":
+		return d.plain(n)
+	case "!binary", "!!binary":
+		if n.kind != scalarNode {
+			return nil, ErrMalformedValue
+		}
+
+		data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(n.value), ""))
+		if err != nil {
+			return nil, ErrMalformedValue
+		}
+
+		return data, nil
+	default:
+		if !strings.HasPrefix(tag, "!ruby/") {
+			return nil, ErrUnsupportedTag
+		}
+
+		kind, class := tag[len("!ruby/"):], ""
+		if i := strings.IndexByte(kind, ':'); i >= 0 {
+			kind, class = kind[:i], kind[i+1:]
+		}
+
+		return d.ruby(n, kind, class)
+	}
+}
+
+// ruby decodes a node tagged with !ruby/kind or !ruby/kind:class.
+func (d *decoder) ruby(n *node, kind, class string) (interface{}, error) {
+	switch kind {
+	case "sym", "symbol":
+		if n.kind != scalarNode {
+			return nil, ErrMalformedValue
+		}
+
+		return marshal.Symbol(n.value), nil
+	case "string":
+		if n.kind == scalarNode {
+			return n.value, nil
+		}
+
+		// String subclasses with instance variables
+		return d.member(n, "str")
+	case "array":
+		if n.kind == mappingNode {
+			return d.member(n, "internal")
+		}
+		if n.kind != sequenceNode {
+			return nil, ErrMalformedValue
+		}
+
+		return d.plain(n)
+	case "hash":
+		if n.kind != mappingNode {
+			return nil, ErrMalformedValue
+		}
+
+		return d.plain(n)
+	case "hash-with-ivars":
+		return d.member(n, "elements")
+	case "range":
+		return d.rubyRange(n)
+	case "struct":
+		fields, err := d.fields(n)
+		if err != nil {
+			return nil, err
+		}
+
+		s := marshal.Struct{Class: class}
+		for _, f := range fields {
+			if !strings.HasPrefix(f.Key.(string), "@") {
+				s.Members = append(s.Members, f)
+			}
+		}
+
+		return s, nil
+	case "marshalable":
+		if n.kind == scalarNode {
+			return nil, ErrMalformedValue
+		}
+
+		data, err := d.plain(n)
+		if err != nil {
+			return nil, err
+		}
+
+		return marshal.UserMarshal{Class: class, Data: data}, nil
+	case "object", "exception":
+		if class == "" {
+			class = "Object"
+		}
+
+		if class == "BigDecimal" && n.kind == scalarNode {
+			return marshal.UserDefined{Class: class, Data: []byte(n.value)}, nil
+		}
+
+		fields, err := d.fields(n)
+		if err != nil {
+			return nil, err
+		}
+
+		return rubyObject(kind, class, fields), nil
+	}
+
+	return nil, ErrUnsupportedTag
+}
+
+func rubyObject(kind, class string, fields []marshal.Pair) interface{} {
+	// OpenStruct dumps its attributes since ostruct 0.3 and the @table
+	// instance variable before, Marshal dumps them with marshal_dump.
+	if class == "OpenStruct" && (len(fields) != 1 || fields[0].Key != "table") {
+		table := make(marshal.Hash, len(fields))
+		for i, f := range fields {
+			table[i] = marshal.Pair{Key: marshal.Symbol(f.Key.(string)), Value: f.Value}
+		}
+
+		return marshal.UserMarshal{Class: class, Data: table}
+	}
+
+	obj := marshal.Object{Class: class, Ivars: make(map[string]interface{}, len(fields))}
+	for _, f := range fields {
+		name := f.Key.(string)
+
+		switch {
+		case kind == "exception" && name == "message":
+			name = "mesg"
+		case kind == "exception" && name == "backtrace":
+			name = "bt"
+		case !strings.HasPrefix(name, "@"):
+			name = "@" + name
+		}
+
+		obj.Ivars[name] = f.Value
+	}
+
+	return obj
+}
+
+func (d *decoder) rubyRange(n *node) (interface{}, error) {
+	r := marshal.Object{Class: "Range", Ivars: map[string]interface{}{"excl": false}}
+
+	switch n.kind {
+	case scalarNode:
+		bounds := rangeBounds.FindStringSubmatch(n.value)
+		if bounds == nil {
+			return nil, ErrMalformedValue
+		}
+
+		r.Ivars["begin"] = tokenize(bounds[1])
+		r.Ivars["end"] = tokenize(bounds[3])
+		r.Ivars["excl"] = bounds[2] == "..."
+	case mappingNode:
+		fields, err := d.fields(n)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range fields {
+			r.Ivars[f.Key.(string)] = f.Value
+		}
+	default:
+		return nil, ErrMalformedValue
+	}
+
+	return r, nil
+}
+
+var rangeBounds = regexp.MustCompile(`^(.*?)(\.\.\.?)(.*)$`)
+
+// fields returns the entries of a mapping with scalar keys, which name the
+// instance variables or members of Ruby objects.
+func (d *decoder) fields(n *node) ([]marshal.Pair, error) {
+	if n.kind != mappingNode {
+		return nil, ErrMalformedValue
+	}
+
+	fields := make([]marshal.Pair, 0, len(n.content)/2)
+	for i := 0; i+1 < len(n.content); i += 2 {
+		if n.content[i].kind != scalarNode {
+			return nil, ErrMalformedValue
+		}
+
+		value, err := d.value(n.content[i+1])
+		if err != nil {
+			return nil, err
+		}
+
+		fields = append(fields, marshal.Pair{Key: n.content[i].value, Value: value})
+	}
+
+	return fields, nil
+}
+
+// member returns the value of the field name of a mapping.
+func (d *decoder) member(n *node, name string) (interface{}, error) {
+	if n.kind != mappingNode {
+		return nil, ErrMalformedValue
+	}
+
+	for i := 0; i+1 < len(n.content); i += 2 {
+		if n.content[i].kind == scalarNode && n.content[i].value == name {
+			return d.value(n.content[i+1])
+		}
+	}
+
+	return nil, ErrMalformedValue
+}
+
+// plain decodes an untagged node or a node with a core schema tag.
+func (d *decoder) plain(n *node) (interface{}, error) {
+	switch n.kind {
+	case scalarNode:
+		if n.tag == "!!str" || n.quoted {
+			return n.value, nil
+		}
+
+		return tokenize(n.value), nil
+	case sequenceNode:
+		array := make([]interface{}, len(n.content))
+		for i, c := range n.content {
+			var err error
+			if array[i], err = d.value(c); err != nil {
+				return nil, err
+			}
+		}
+
+		return array, nil
+	case mappingNode:
+		hash := make(marshal.Hash, 0, len(n.content)/2)
+		for i := 0; i+1 < len(n.content); i += 2 {
+			key, err := d.value(n.content[i])
+			if err != nil {
+				return nil, err
+			}
+
+			value, err := d.value(n.content[i+1])
+			if err != nil {
+				return nil, err
+			}
+
+			hash = append(hash, marshal.Pair{Key: key, Value: value})
+		}
+
+		return hash, nil
+	}
+
+	return nil, ErrMalformedValue
+}
+
+var (
+	nullScalar    = regexp.MustCompile(`^(?:~|null|Null|NULL)$`)
+	trueScalar    = regexp.MustCompile(`^(?i:yes|true|on)$`)
+	falseScalar   = regexp.MustCompile(`^(?i:no|false|off)$`)
+	integerScalar = regexp.MustCompile(`^(?:[-+]?0b[0-1_,]+|[-+]?0[0-7_,]+|[-+]?(?:0|[1-9](?:[0-9]|,[0-9]|_[0-9])*)|[-+]?0x[0-9a-fA-F_,]+)$`)
+	floatScalar   = regexp.MustCompile(`^[-+]?(?:[0-9][0-9_,]*)?\.[0-9]*(?:[eE][-+][0-9]+)?$`)
+	quotedSymbol  = regexp.MustCompile(`^:(["'])(.*)["']$`)
+)
+
+// tokenize resolves a plain scalar the way Psych::ScalarScanner does.
+func tokenize(s string) interface{} {
+	switch {
+	case s == "" || nullScalar.MatchString(s):
+		return nil
+	case trueScalar.MatchString(s):
+		return true
+	case falseScalar.MatchString(s):
+		return false
+	case len(s) > 1 && s[0] == ':':
+		if m := quotedSymbol.FindStringSubmatch(s); m != nil {
+			return marshal.Symbol(m[2])
+		}
+		return marshal.Symbol(s[1:])
+	case strings.EqualFold(s, ".inf") || strings.EqualFold(s, "+.inf"):
+		return math.Inf(1)
+	case strings.EqualFold(s, "-.inf"):
+		return math.Inf(-1)
+	case strings.EqualFold(s, ".nan"):
+		return math.NaN()
+	}
+
+	digits := strings.NewReplacer("_", "", ",", "").Replace(s)
+
+	if integerScalar.MatchString(s) {
+		if i, err := strconv.ParseInt(digits, 0, 64); err == nil {
+			return i
+		}
+	}
+
+	if floatScalar.MatchString(s) && s != "." && s != "-." && s != "+." {
+		if f, err := strconv.ParseFloat(strings.TrimSuffix(digits, "."), 64); err == nil {
+			return f
+		}
+	}
+
+	return s
+}
@@ -0,0 +1,115 @@
+package yaml
+
+import (
+	"testing"
+)
+
+type loadTestCase struct {
+	Document    string
+	Expectation string
+}
+
+func TestLoad(t *testing.T) {
+	tests := []loadTestCase{
+		{"", "nil"},
+		{"--- ~\n", "nil"},
+		{"--- 42\n", "42"},
+		{"--- 1_000\n", "1000"},
+		{"--- 0x1f\n", "31"},
+		{"--- 1.5\n", "1.5"},
+		{"--- -.inf\n", "-Infinity"},
+		{"--- yes\n", "true"},
+		{"--- Off\n", "false"},
+		{"--- foo\n", `"foo"`},
+		{"--- '42'\n", `"42"`},
+		{"--- !!str 42\n", `"42"`},
+		{"--- 2024-01-01 12:00:00 Z\n", `"2024-01-01 12:00:00 Z"`},
+		{"--- :foo\n", ":foo"},
+		{"--- :\"foo bar\"\n", `:"foo bar"`},
+		{"--- !ruby/symbol foo\n", ":foo"},
+		{"--- !binary |-\n  AAEC\n", `"\x00\x01\x02"`},
+		{"---\n- 1\n- two\n- :three\n", `[1, "two", :three]`},
+		{"---\n:b: 1\na: 2\n", `{:b=>1, "a"=>2}`},
+		{"---\n- &a foo\n- *a\n", `["foo", "foo"]`},
+		{"--- !ruby/hash:ActiveSupport::HashWithIndifferentAccess\nid: 1\n", `{"id"=>1}`},
+		{"--- !ruby/hash-with-ivars:ActionController::Parameters\nelements:\n  id: 1\nivars:\n  :@permitted: false\n", `{"id"=>1}`},
+		{"--- !ruby/array:Tags\n- a\n", `["a"]`},
+		{"--- !ruby/string:Name\nstr: bob\n\"@x\": 1\n", `"bob"`},
+		{"--- !ruby/range 1..3\n", "#<Range begin=1, end=3, excl=false>"},
+		{"--- !ruby/range\nbegin: 1\nend: 3\nexcl: true\n", "#<Range begin=1, end=3, excl=true>"},
+		{"--- !ruby/object:BigDecimal 18:0.1e1\n", `#<BigDecimal _dump="18:0.1e1">`},
+		{"--- !ruby/struct:Point\nx: 1\ny: 2\n", "#<struct Point x=1, y=2>"},
+		{"--- !ruby/object:Foo\nbar: 1\n", "#<Foo @bar=1>"},
+		{"--- !ruby/object:OpenStruct\nname: bob\n", `#<OpenStruct marshal_dump={:name=>"bob"}>`},
+		{"--- !ruby/exception:ArgumentError\nmessage: boom\n", `#<ArgumentError mesg="boom">`},
+	}
+
+	for _, testCase := range tests {
+		obj, err := Load([]byte(testCase.Document))
+		if err != nil {
+			t.Errorf("Load(%q) returned an error: %v", testCase.Document, err)
+			continue
+		}
+
+		if value := obj.Inspect(); value != testCase.Expectation {
+			t.Errorf("Load(%q) returned %s instead of %s", testCase.Document, value, testCase.Expectation)
+		}
+	}
+}
+
+type loadErrorTestCase struct {
+	Document string
+	Error    error
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []loadErrorTestCase{
+		{"--- !ruby/regexp /foo/\n", ErrUnsupportedTag},
+		{"--- !custom 1\n", ErrUnsupportedTag},
+		{"--- !ruby/object:Foo\n- 1\n", ErrMalformedValue},
+		{"--- !ruby/range foo\n", ErrMalformedValue},
+		{"--- &a\n- *a\n", ErrRecursiveAlias},
+	}
+
+	for _, testCase := range tests {
+		if _, err := Load([]byte(testCase.Document)); err != testCase.Error {
+			t.Errorf("Load(%q) returned %v instead of %v", testCase.Document, err, testCase.Error)
+		}
+	}
+}
+
+const delayedJobHandler = `--- !ruby/object:Delayed::PerformableMethod
+object: !ruby/object:User
+  raw_attributes:
+    id: 42
+    email: bob@example.com
+method_name: :deliver_welcome
+args:
+- :en
+- 3
+`
+
+type performableMethod struct {
+	Object struct {
+		RawAttributes map[string]interface{} `ruby:"raw_attributes"`
+	} `ruby:"object"`
+	MethodName string        `ruby:"method_name"`
+	Args       []interface{} `ruby:"args"`
+}
+
+func TestUnmarshal(t *testing.T) {
+	var handler performableMethod
+	if err := Unmarshal([]byte(delayedJobHandler), &handler); err != nil {
+		t.Fatalf("Unmarshal() returned an error: %v", err)
+	}
+
+	if handler.MethodName != "deliver_welcome" {
+		t.Errorf("Unmarshal() decoded method name %q", handler.MethodName)
+	}
+	if email := handler.Object.RawAttributes["email"]; email != "bob@example.com" {
+		t.Errorf("Unmarshal() decoded email %v", email)
+	}
+	if len(handler.Args) != 2 || handler.Args[0] != "en" {
+		t.Errorf("Unmarshal() decoded arguments %v", handler.Args)
+	}
+}